@@ -0,0 +1,103 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/shiftstack/bugwatcher/pkg/query"
+	"github.com/shiftstack/ghira/pkg/jiraclient"
+)
+
+const dedupeUsage = `Usage:
+  ghira dedupe [-dry-run] [-lock-file FILE] [-jira-lease DURATION]
+
+Close the Jira issues that duplicate the synced Jira issue of the same Github
+issue: the one linked with "ghira link", or else the oldest one. Their
+comments are copied to the synced issue and their links moved to it; they are
+then linked to it and closed with the Duplicate resolution.
+`
+
+// dedupeCommand runs "ghira dedupe", which merges the Jira issues mirroring
+// the same Github issue, and returns the exit code.
+func dedupeCommand(args []string) int {
+	handler, _ := newLogHandler("text", slog.LevelInfo)
+	slog.SetDefault(slog.New(handler).With("repo", githubRepository))
+
+	flags := flag.NewFlagSet("dedupe", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), dedupeUsage) }
+	dryRun := flags.Bool("dry-run", false, "List the duplicates without changing them.")
+	lockFile := flags.String("lock-file", filepath.Join(os.TempDir(), "ghira.lock"), "Path of the file locked while merging, as in the sync.")
+	jiraLease := flags.Duration("jira-lease", 0, "Duration of the Jira lease held while merging, as in the sync.")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if JIRA_EMAIL == "" || JIRA_TOKEN == "" {
+		slog.Error("Required environment variables not found", "variables", []string{"JIRA_EMAIL", "JIRA_TOKEN"})
+		return exitUsage
+	}
+	jiraClient, err := jiraclient.NewWithToken(query.JiraBaseURL, JIRA_EMAIL, JIRA_TOKEN, nil, time.Minute)
+	if err != nil {
+		slog.Error("Unable to build a Jira client", "error", err)
+		return exitFatal
+	}
+	tracker := newTracker(jiraClient)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if locks := newLocks(*lockFile, *jiraLease, jiraClient); len(locks) > 0 && !*dryRun {
+		locked, release, err := locks.Acquire(ctx)
+		if err != nil {
+			slog.Error("Unable to acquire the lock", "error", err)
+			return exitFatal
+		}
+		defer release()
+		ctx = locked
+	}
+
+	known, err := tracker.KnownIssues(ctx)
+	if err != nil {
+		slog.Error("Unable to list the Jira issues", "error", err)
+		return exitFatal
+	}
+
+	var merged, failed int
+	for _, n := range slices.SortedFunc(maps.Keys(known), cmp.Compare) {
+		issue := known[n]
+		for _, duplicate := range issue.Duplicates {
+			logger := slog.With("gh_number", n, "jira_key", issue.Key, "duplicate", duplicate, "action", "dedupe")
+			if *dryRun {
+				logger.Info("Found a duplicate")
+				continue
+			}
+			if ctx.Err() != nil {
+				slog.Error("Interrupted", "error", ctx.Err())
+				return exitPartial
+			}
+			if err := tracker.Merge(context.WithoutCancel(ctx), issue.Key, duplicate); err != nil {
+				logger.Error("Unable to merge the duplicate", "error", err)
+				failed++
+				continue
+			}
+			logger.Info("Merged the duplicate")
+			merged++
+		}
+	}
+
+	slog.Info("Dedupe summary", "merged", merged, "failed", failed, "dry_run", *dryRun)
+	if failed > 0 {
+		return exitPartial
+	}
+	return 0
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/journal"
+)
+
+const journalUsage = `Usage:
+  ghira journal list -journal FILE            List the changes waiting for a retry and the dead-lettered ones.
+  ghira journal retry -journal FILE NUMBER    Retry the dead-lettered changes of a Github issue at the next run.
+  ghira journal drop -journal FILE NUMBER     Forget the failed changes of a Github issue.
+
+Stop ghira before changing the journal: retry and drop fail while another
+ghira process has it open.
+`
+
+// retryInterval is how often "ghira serve" looks for changes to retry.
+const retryInterval = 30 * time.Second
+
+// retryDue syncs the issues whose failed changes can be retried, until ctx is
+// cancelled.
+func retryDue(ctx context.Context, changes *journal.Journal, sync func(ctx context.Context, number int)) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			due := changes.Due(time.Now())
+			for _, number := range due {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.Info("Retrying failed changes", "gh_number", number, "action", "retry")
+				sync(ctx, number)
+			}
+			if len(due) > 0 {
+				compactJournal(changes)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// compactJournal drops the completed changes from the journal, so that it
+// does not grow for as long as the daemon runs.
+func compactJournal(changes *journal.Journal) {
+	if err := changes.Compact(); err != nil {
+		slog.Error("Unable to compact the journal", "error", err)
+	}
+}
+
+// journalCommand runs "ghira journal", which inspects the journal, and
+// returns the exit code.
+func journalCommand(args []string) int {
+	handler, _ := newLogHandler("text", slog.LevelInfo)
+	slog.SetDefault(slog.New(handler).With("repo", githubRepository))
+
+	flags := flag.NewFlagSet("journal", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), journalUsage) }
+	journalFile := flags.String("journal", "", "Path of the journal file.")
+
+	if len(args) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	command := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	if *journalFile == "" {
+		slog.Error("Missing the path of the journal: set -journal")
+		return exitUsage
+	}
+
+	var number int
+	if command == "retry" || command == "drop" {
+		var err error
+		if number, err = strconv.Atoi(flags.Arg(0)); err != nil || number < 1 {
+			slog.Error("Invalid Github issue number", "number", flags.Arg(0))
+			return exitUsage
+		}
+	}
+
+	if command == "list" {
+		// The journal is only read, so that listing it doesn't disturb
+		// a running ghira.
+		entries, err := journal.Read(*journalFile)
+		if err != nil {
+			slog.Error("Unable to read the journal", "error", err)
+			return exitFatal
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NUMBER\tJIRA KEY\tACTION\tDETAIL\tSTATE\tATTEMPTS\tRETRY AT\tERROR")
+		for _, e := range entries {
+			retryAt := "-"
+			if e.State == journal.Failed {
+				retryAt = e.RetryAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "#%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", e.Number, e.Key, e.Action, e.Detail, e.State, e.Attempts, retryAt, e.LastError)
+		}
+		if err := w.Flush(); err != nil {
+			slog.Error("Unable to list the journal", "error", err)
+			return exitFatal
+		}
+		return 0
+	}
+
+	changes, err := journal.Open(*journalFile)
+	if err != nil {
+		slog.Error("Unable to open the journal", "error", err)
+		return exitFatal
+	}
+	defer changes.Close()
+
+	switch command {
+	case "retry":
+		n, err := changes.Retry(number)
+		if err != nil {
+			slog.Error("Unable to retry the changes", "gh_number", number, "error", err)
+			return exitFatal
+		}
+		slog.Info("Moved the dead-lettered changes back to the retry queue", "gh_number", number, "count", n)
+
+	case "drop":
+		n, err := changes.Drop(number)
+		if err != nil {
+			slog.Error("Unable to drop the changes", "gh_number", number, "error", err)
+			return exitFatal
+		}
+		slog.Info("Dropped the failed changes", "gh_number", number, "count", n)
+
+	default:
+		flags.Usage()
+		return exitUsage
+	}
+	return 0
+}
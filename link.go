@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/shiftstack/bugwatcher/pkg/query"
+	"github.com/shiftstack/ghira/pkg/jiraclient"
+	"github.com/shiftstack/ghira/pkg/state"
+)
+
+const linkUsage = `Usage:
+  ghira link [-summary] [-force] [-state-file FILE] [-lock-file FILE] [-jira-lease DURATION] NUMBER KEY
+      Mirror the Github issue NUMBER with the existing Jira issue KEY.
+  ghira unlink [-summary] [-state-file FILE] [-lock-file FILE] [-jira-lease DURATION] NUMBER KEY
+      Stop mirroring the Github issue NUMBER with the Jira issue KEY.
+
+The links are recorded in the "ghira.links" property of the Jira project,
+while holding the same locks as the sync.
+With -summary, the summary of the Jira issue also gets the "GH-orc-NUMBER: "
+prefix, or loses it. A Github issue already linked to another Jira issue, and
+a Jira issue whose summary mirrors another Github issue, are only linked with
+-force.
+
+Writing the links requires the "Administer Projects" permission.
+`
+
+// linkCommand runs "ghira link" or "ghira unlink", which manage the Jira
+// issues associated with a Github issue by hand, and returns the exit code.
+func linkCommand(command string, args []string) int {
+	handler, _ := newLogHandler("text", slog.LevelInfo)
+	slog.SetDefault(slog.New(handler).With("repo", githubRepository))
+
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), linkUsage) }
+	rewriteSummary := flags.Bool("summary", false, "Also add or remove the prefix of the summary.")
+	force := flags.Bool("force", false, "Link a Jira issue even if the Github issue is linked to another one, or its summary mirrors another Github issue.")
+	stateFile := flags.String("state-file", "", "Path of the state file to update, if any.")
+	lockFile := flags.String("lock-file", filepath.Join(os.TempDir(), "ghira.lock"), "Path of the file locked while linking, as in the sync.")
+	jiraLease := flags.Duration("jira-lease", 0, "Duration of the Jira lease held while linking, as in the sync.")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+	number, err := strconv.Atoi(flags.Arg(0))
+	if err != nil || number < 1 {
+		slog.Error("Invalid Github issue number", "number", flags.Arg(0))
+		return exitUsage
+	}
+	key := flags.Arg(1)
+
+	if JIRA_EMAIL == "" || JIRA_TOKEN == "" {
+		slog.Error("Required environment variables not found", "variables", []string{"JIRA_EMAIL", "JIRA_TOKEN"})
+		return exitUsage
+	}
+	jiraClient, err := jiraclient.NewWithToken(query.JiraBaseURL, JIRA_EMAIL, JIRA_TOKEN, nil, time.Minute)
+	if err != nil {
+		slog.Error("Unable to build a Jira client", "error", err)
+		return exitFatal
+	}
+	tracker := newTracker(jiraClient)
+
+	var store *state.Store
+	if *stateFile != "" {
+		if store, err = state.Open(*stateFile); err != nil {
+			slog.Error("Unable to open the state file", "error", err)
+			return exitFatal
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	logger := slog.With("gh_number", number, "jira_key", key)
+
+	if locks := newLocks(*lockFile, *jiraLease, jiraClient); len(locks) > 0 {
+		locked, release, err := locks.Acquire(ctx)
+		if err != nil {
+			slog.Error("Unable to acquire the lock", "error", err)
+			return exitFatal
+		}
+		defer release()
+		ctx = locked
+	}
+
+	switch command {
+	case "link":
+		if err := tracker.Link(ctx, number, key, *rewriteSummary, *force); err != nil {
+			logger.Error("Unable to link the issues", "error", err)
+			return exitFatal
+		}
+		logger.Info("Linked the issues")
+		if store != nil {
+			store.SetKey(githubRepository, number, key)
+		}
+		if known, ok, err := tracker.KnownIssue(ctx, number); err == nil && ok && len(known.Duplicates) > 0 {
+			logger.Warn("Other Jira issues mirror the Github issue: run ghira dedupe to close them", "duplicates", known.Duplicates)
+		}
+
+	case "unlink":
+		if err := tracker.Unlink(ctx, number, key, *rewriteSummary); err != nil {
+			logger.Error("Unable to unlink the issues", "error", err)
+			return exitFatal
+		}
+		logger.Info("Unlinked the issues")
+		if store != nil {
+			if recorded, ok := store.Issue(githubRepository, number); ok && recorded.Key == key {
+				store.Delete(githubRepository, number)
+			}
+		}
+
+	default:
+		flags.Usage()
+		return exitUsage
+	}
+
+	if store != nil {
+		if err := store.Save(); err != nil {
+			slog.Error("Unable to save the state", "error", err)
+			return exitFatal
+		}
+	}
+	return 0
+}
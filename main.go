@@ -2,20 +2,37 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"regexp"
-	"strconv"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	jira "github.com/andygrunwald/go-jira"
-	"github.com/shiftstack/bugwatcher/pkg/jiraclient"
 	"github.com/shiftstack/bugwatcher/pkg/query"
 	"github.com/shiftstack/bugwatcher/pkg/team"
+	"github.com/shiftstack/ghira/pkg/config"
+	"github.com/shiftstack/ghira/pkg/daemon"
+	"github.com/shiftstack/ghira/pkg/github"
+	"github.com/shiftstack/ghira/pkg/jiraclient"
+	"github.com/shiftstack/ghira/pkg/jiratracker"
+	"github.com/shiftstack/ghira/pkg/journal"
+	"github.com/shiftstack/ghira/pkg/lock"
+	"github.com/shiftstack/ghira/pkg/metrics"
+	"github.com/shiftstack/ghira/pkg/reconcile"
+	"github.com/shiftstack/ghira/pkg/report"
+	"github.com/shiftstack/ghira/pkg/reverse"
+	"github.com/shiftstack/ghira/pkg/state"
+	"github.com/shiftstack/ghira/pkg/webhook"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -23,287 +40,554 @@ const (
 	shiftStackQuery  = `project = "OSASINFRA" AND (component in ("ORC"))`
 )
 
+// Exit codes.
+const (
+	exitFatal   = 1  // The run could not complete.
+	exitPartial = 2  // Some issues could not be reconciled.
+	exitUsage   = 64 // The flags or the environment are invalid.
+)
+
 var (
 	GITHUB_TOKEN = os.Getenv("GITHUB_TOKEN")
 	JIRA_EMAIL   = os.Getenv("JIRA_EMAIL")
 	JIRA_TOKEN   = os.Getenv("JIRA_TOKEN")
 	PEOPLE       = os.Getenv("PEOPLE")
 
-	ghIssueNumberRegex = regexp.MustCompile(`GH-orc-(\d+): `)
-	linkHeaderRegex    = regexp.MustCompile(`<(\S+)>; rel="next"`)
+	// GITHUB_WEBHOOK_SECRET and JIRA_WEBHOOK_SECRET enable the webhook
+	// receivers of "ghira serve".
+	GITHUB_WEBHOOK_SECRET = os.Getenv("GITHUB_WEBHOOK_SECRET")
+	JIRA_WEBHOOK_SECRET   = os.Getenv("JIRA_WEBHOOK_SECRET")
 )
 
-type GithubIssue struct {
-	Title  string `json:"title"`
-	Body   string `json:"body_text"`
-	URL    string `json:"html_url"`
-	Number int    `json:"number"`
-	Author struct {
-		Handle        string `json:"login"`
-		JiraAccountID string `json:"-"`
-	} `json:"user"`
-	Assignee struct {
-		Handle        string `json:"login"`
-		JiraAccountID string `json:"-"`
-	} `json:"assignee"`
-	Status string `json:"state"`
-	IsPR   any    `json:"pull_request"`
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ghira")
 }
 
-// ResolveNames resolves Github handles to Jira account IDs.
-func ResolveNames(issues <-chan GithubIssue, teamMembers []team.Person) <-chan GithubIssue {
-	out := make(chan GithubIssue)
+// newLogHandler returns a slog handler writing to stderr in the given format,
+// "text" or "json".
+func newLogHandler(format string, level slog.Level) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "text":
+		return slog.NewTextHandler(os.Stderr, opts), nil
+	case "json":
+		return slog.NewJSONHandler(os.Stderr, opts), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: must be \"text\" or \"json\"", format)
+	}
+}
 
-	go func() {
-		defer close(out)
+// fatal logs an error and exits with the given code.
+func fatal(code int, msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(code)
+}
 
-		for i := range issues {
-			if i.Author.Handle != "" {
-				if author, ok := team.PersonByGithubHandle(teamMembers, i.Author.Handle); ok {
-					i.Author.JiraAccountID = author.JiraAccountID
-				}
-			}
+// writeReport writes a report to path, or to stdout if path is "-".
+func writeReport(path string, write func(io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
 
-			if i.Assignee.Handle != "" {
-				if assignee, ok := team.PersonByGithubHandle(teamMembers, i.Assignee.Handle); ok {
-					i.Assignee.JiraAccountID = assignee.JiraAccountID
-				}
-			}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
 
-			out <- i
-		}
-	}()
-	return out
+// newLocks returns the locks held while making changes: the lock file, if
+// set, and the Jira lease, if it has a duration.
+func newLocks(lockFile string, jiraLease time.Duration, jiraClient *jira.Client) lock.All {
+	var locks lock.All
+	if lockFile != "" {
+		locks = append(locks, &lock.File{Path: lockFile})
+	}
+	if jiraLease > 0 {
+		locks = append(locks, &lock.JiraLease{Client: jiraClient, Project: "OSASINFRA", TTL: jiraLease})
+	}
+	return locks
 }
 
-func fetchGitHubIssues(ctx context.Context, token string) <-chan GithubIssue {
-	issueCh := make(chan GithubIssue)
+func main() {
+	var (
+		cacheDir       string
+		githubAPI      string
+		concurrency    int
+		jiraRate       float64
+		requestTimeout time.Duration
+		runTimeout     time.Duration
+		reportJSON     string
+		reportMarkdown string
+		logFormat      string
+		logLevel       slog.Level
+		metricsFile    string
+		metricsPushURL string
+		configPath     string
+		stateFile      string
+		journalFile    string
+		lockFile       string
+		jiraLease      time.Duration
+
+		listenAddr string
+		interval   time.Duration
+		jitter     time.Duration
+	)
+
+	// "ghira serve" runs the reconciliation on a schedule instead of
+	// once.
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "state" {
+		os.Exit(stateCommand(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "journal" {
+		os.Exit(journalCommand(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "dedupe" {
+		os.Exit(dedupeCommand(args[1:]))
+	}
+	if len(args) > 0 && (args[0] == "link" || args[0] == "unlink") {
+		os.Exit(linkCommand(args[0], args[1:]))
+	}
+	serve := len(args) > 0 && args[0] == "serve"
+	if serve {
+		args = args[1:]
+		flag.StringVar(&listenAddr, "listen", ":8080", "Address of the health and metrics endpoints.")
+		flag.DurationVar(&interval, "interval", 15*time.Minute, "Time between the end of a run and the start of the next one.")
+		flag.DurationVar(&jitter, "jitter", time.Minute, "Maximum random delay added to the interval.")
+	}
+	flag.StringVar(&configPath, "config", "", "Path of the YAML configuration file.")
+	flag.StringVar(&stateFile, "state-file", "", "Path of the state file, which records the mirrored issues and their synced values. Set to empty to disable.")
+	flag.StringVar(&journalFile, "journal", "", "Path of the journal file, which records the changes so that the failed ones are retried. Set to empty to disable.")
+	flag.StringVar(&lockFile, "lock-file", filepath.Join(os.TempDir(), "ghira.lock"), "Path of the file locked during each run, so that the runs on this host don't overlap. Set to empty to disable.")
+	flag.DurationVar(&jiraLease, "jira-lease", 0, "Duration of a lease stored in the Jira project and held during each run, so that the replicas on different hosts don't overlap. It requires the Administer Projects permission. Set to 0 to disable.")
+	flag.StringVar(&cacheDir, "cache-dir", defaultCacheDir(), "Directory for the Github response cache. Set to empty to disable caching.")
+	flag.StringVar(&githubAPI, "github-api", "rest", `Github API used to fetch issues: "rest", or "graphql" to also fetch comments and linked pull requests.`)
+	flag.IntVar(&concurrency, "concurrency", 4, "Number of Github issues processed concurrently.")
+	flag.Float64Var(&jiraRate, "jira-rate", 10, "Maximum number of Jira requests per second, shared by all workers. Set to 0 to disable the limit.")
+	flag.DurationVar(&requestTimeout, "request-timeout", time.Minute, "Timeout of each Github and Jira request attempt. Set to 0 to disable.")
+	flag.DurationVar(&runTimeout, "timeout", 0, "Timeout of the whole run. When it expires, the issues in flight are finished and the run stops. Set to 0 to disable.")
+	flag.StringVar(&reportJSON, "report-json", "", `Write the run report as JSON to this file ("-" for stdout).`)
+	flag.StringVar(&reportMarkdown, "report-markdown", "", `Write the run report as Markdown to this file ("-" for stdout).`)
+	flag.StringVar(&logFormat, "log-format", "text", `Log format: "text" or "json".`)
+	flag.TextVar(&logLevel, "log-level", slog.LevelInfo, `Minimum log level: "debug", "info", "warn" or "error".`)
+	flag.StringVar(&metricsFile, "metrics-textfile", "", "Write the Prometheus metrics to this file at the end of each run, for the node_exporter textfile collector.")
+	flag.StringVar(&metricsPushURL, "metrics-push-url", "", "Push the Prometheus metrics to the Pushgateway at this URL at the end of each run.")
+	flag.CommandLine.Parse(args)
+
+	{
+		handler, err := newLogHandler(logFormat, logLevel)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+		slog.SetDefault(slog.New(handler).With("repo", githubRepository))
+	}
+
+	checkEnvironment()
 
+	var conf config.Config
+	if configPath != "" {
+		var err error
+		if conf, err = config.Load(configPath); err != nil {
+			fatal(exitUsage, "Invalid configuration", "error", err)
+		}
+	}
+
+	// githubREST is also used for the writes of the reverse sync.
+	githubClient := github.NewHTTPClient(cacheDir, requestTimeout)
+	githubREST := &github.REST{Client: githubClient, Token: GITHUB_TOKEN, Repository: githubRepository}
+
+	var source reconcile.Source
+	switch githubAPI {
+	case "rest":
+		source = githubREST
+	case "graphql":
+		source = &github.GraphQL{Client: githubClient, Token: GITHUB_TOKEN, Repository: githubRepository}
+	default:
+		fatal(exitUsage, "Invalid Github API: must be \"rest\" or \"graphql\"", "github_api", githubAPI)
+	}
+
+	if concurrency < 1 {
+		fatal(exitUsage, "Invalid concurrency: must be at least 1", "concurrency", concurrency)
+	}
+	if serve && interval <= 0 {
+		fatal(exitUsage, "Invalid interval: must be positive", "interval", interval)
+	}
+
+	var jiraLimiter *rate.Limiter
+	if jiraRate > 0 {
+		jiraLimiter = rate.NewLimiter(rate.Limit(jiraRate), concurrency)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func() {
-		defer close(issueCh)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		slog.Warn("Received signal: finishing the issues in flight. Send it again to exit immediately.", "signal", sig.String())
+		// Restore the default behaviour, so that a second signal
+		// terminates the process.
+		signal.Stop(signals)
+		cancel()
+	}()
 
-		// https://docs.github.com/en/rest/issues/issues?apiVersion=2022-11-28#list-repository-issues
-		client := &http.Client{}
-		url := fmt.Sprintf("https://api.github.com/repos/%s/issues", githubRepository)
-		for url != "" {
-			req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-			if err != nil {
-				log.Fatalf("error fetching issues: %v", err)
-				return
+	people, err := team.Load(strings.NewReader(PEOPLE))
+	if err != nil {
+		fatal(exitFatal, "Unable to load the team information", "error", err)
+	}
+
+	jiraClient, err := jiraclient.NewWithToken(query.JiraBaseURL, JIRA_EMAIL, JIRA_TOKEN, jiraLimiter, requestTimeout)
+	if err != nil {
+		fatal(exitFatal, "Unable to build a Jira client", "error", err)
+	}
+
+	// The reconciler, its clients and their caches are reused across runs
+	// in serve mode.
+	tracker := newTracker(jiraClient)
+	var (
+		store            *state.Store
+		reconcileTracker reconcile.Tracker = tracker
+	)
+	if stateFile != "" {
+		if store, err = state.Open(stateFile); err != nil {
+			fatal(exitFatal, "Unable to open the state file", "error", err)
+		}
+		reconcileTracker = &state.Tracker{Tracker: tracker, Store: store, Repository: githubRepository}
+	}
+	saveState := func() {
+		if store == nil {
+			return
+		}
+		if err := store.Save(); err != nil {
+			slog.Error("Unable to save the state", "error", err)
+		}
+	}
+
+	reconciler := &reconcile.Reconciler{
+		Source:        source,
+		Tracker:       reconcileTracker,
+		Github:        githubREST,
+		Locator:       githubREST,
+		Fields:        conf.Fields,
+		ReverseStatus: conf.Reverse.Status(),
+		Orphans:       conf.Orphans,
+		People:        people,
+		Concurrency:   concurrency,
+	}
+	var changes *journal.Journal
+	if journalFile != "" {
+		if changes, err = journal.Open(journalFile); err != nil {
+			fatal(exitFatal, "Unable to open the journal", "error", err)
+		}
+		defer changes.Close()
+		reconciler.Journal = changes
+	}
+	if locks := newLocks(lockFile, jiraLease, jiraClient); len(locks) > 0 {
+		reconciler.Lock = locks
+	}
+
+	// runOnce runs a reconciliation and reports its outcome.
+	runOnce := func(ctx context.Context) (reconcile.Result, error) {
+		if runTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, runTimeout)
+			defer cancel()
+		}
+
+		startedAt := time.Now()
+		result, err := reconciler.Run(ctx)
+		saveState()
+		if changes != nil {
+			compactJournal(changes)
+		}
+		slog.Info("Run summary",
+			"seen", result.Seen,
+			"created", len(result.Created),
+			"transitioned", len(result.Transitioned),
+			"updated", len(result.Updated),
+			"skipped", len(result.Skipped),
+			"failed", len(result.Failures),
+			"conflicts", len(result.Conflicts),
+			"duplicates", len(result.Duplicates),
+			"orphans", len(result.Orphans),
+			"duration", time.Since(startedAt),
+		)
+		for _, f := range result.Failures {
+			slog.Error("Issue not reconciled", "gh_number", f.Number, "jira_key", f.Key, "error", f.Err)
+		}
+		if err != nil {
+			slog.Error("The run did not complete", "error", err)
+		}
+
+		metrics.ObserveRun(metrics.Run{
+			Seen:         result.Seen,
+			Created:      len(result.Created),
+			Transitioned: len(result.Transitioned),
+			Updated:      len(result.Updated),
+			Skipped:      len(result.Skipped),
+			Failed:       len(result.Failures),
+			Err:          err,
+			Duration:     time.Since(startedAt),
+		})
+		if metricsFile != "" {
+			if err := metrics.WriteTextfile(metricsFile); err != nil {
+				slog.Error("Unable to write the metrics", "error", err)
 			}
-			if token != "" {
-				req.Header.Set("Authorization", "Bearer "+token)
-				req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
-				req.Header.Set("Accept", "application/vnd.github.text+json") // Don't need the Markdown version
+		}
+		if metricsPushURL != "" {
+			if err := metrics.Push(metricsPushURL); err != nil {
+				slog.Error("Unable to push the metrics", "error", err)
 			}
-			{
-				q := req.URL.Query()
-				q.Add("state", "all")
-				req.URL.RawQuery = q.Encode()
+		}
+
+		runReport := report.New(githubRepository, startedAt, time.Now(), result, err)
+		if reportJSON != "" {
+			if err := writeReport(reportJSON, runReport.WriteJSON); err != nil {
+				slog.Error("Unable to write the JSON report", "error", err)
+			}
+		}
+		if reportMarkdown != "" {
+			if err := writeReport(reportMarkdown, runReport.WriteMarkdown); err != nil {
+				slog.Error("Unable to write the Markdown report", "error", err)
 			}
+		}
 
-			res, err := client.Do(req)
+		return result, err
+	}
+
+	if serve {
+		var endpoints []endpoint
+		if changes != nil {
+			// Retry the failed changes as their backoff expires,
+			// rather than at the next run.
+			endpoints = append(endpoints, endpoint{run: func(ctx context.Context) {
+				retryDue(ctx, changes, func(ctx context.Context, number int) {
+					result, err := reconciler.SyncIssue(ctx, number)
+					saveState()
+					if err != nil {
+						slog.Error("Unable to sync issue", "gh_number", number, "error", err)
+					}
+					observeSync(result, err)
+				})
+			}})
+		}
+		if GITHUB_WEBHOOK_SECRET != "" {
+			// Ignore the deliveries about the changes made by the
+			// reverse sync.
+			login, err := githubREST.Login(ctx)
 			if err != nil {
-				log.Fatalf("error fetching issues: %v", err)
-				return
+				fatal(exitFatal, "Unable to identify the Github user", "error", err)
 			}
-			defer func() {
-				io.Copy(io.Discard, res.Body)
-				res.Body.Close()
-			}()
-
-			if statusCode := res.StatusCode; statusCode != 200 {
-				body, err := io.ReadAll(res.Body)
+			queue := webhook.NewQueue(func(ctx context.Context, number int) {
+				result, err := reconciler.SyncIssue(ctx, number)
+				saveState()
 				if err != nil {
-					log.Fatalf("Status code %d from Github. Additionally, reading the body errored with: %v", statusCode, err)
-					return
+					slog.Error("Unable to sync issue", "gh_number", number, "error", err)
 				}
-				log.Fatalf("Status code %d from Github: %s", statusCode, body)
-				return
-			}
-			var issueBatch []GithubIssue
-			err = json.NewDecoder(res.Body).Decode(&issueBatch)
-			if err != nil {
-				log.Fatalf("error decoding Github issues: %v", err)
-				return
-			}
-			for _, issue := range issueBatch {
-				if issue.IsPR == nil {
-					issueCh <- issue
+				for _, f := range result.Failures {
+					slog.Error("Issue not reconciled", "gh_number", f.Number, "jira_key", f.Key, "error", f.Err)
 				}
+				observeSync(result, err)
+			})
+			endpoints = append(endpoints, endpoint{
+				pattern: "POST /webhooks/github",
+				handler: &webhook.Github{
+					Secret:        []byte(GITHUB_WEBHOOK_SECRET),
+					Repository:    githubRepository,
+					Queue:         queue,
+					IgnoreSenders: []string{login},
+				},
+				run: queue.Run,
+			})
+		}
+		if JIRA_WEBHOOK_SECRET != "" {
+			// Ignore the deliveries about the changes made by the
+			// forward sync.
+			self, _, err := jiraClient.User.GetSelfWithContext(ctx)
+			if err != nil {
+				fatal(exitFatal, "Unable to identify the Jira user", "error", err)
 			}
-
-			url = ""
-			if linkHeader := res.Header.Get("link"); linkHeader != "" {
-				if s := linkHeaderRegex.FindStringSubmatch(linkHeader); len(s) > 1 {
-					url = s[1]
-				}
+			handlers := []reverse.Handler{&reverse.StatusSync{
+				Github:      githubREST,
+				Rules:       conf.Reverse,
+				JiraBaseURL: query.JiraBaseURL,
+			}}
+			if conf.Reverse.Assignee {
+				handlers = append(handlers, &reverse.AssigneeSync{Github: githubREST, People: people})
 			}
+			pipeline := reverse.NewPipeline(100, handlers...)
+			endpoints = append(endpoints, endpoint{
+				pattern: "POST /webhooks/jira",
+				handler: &webhook.Jira{
+					Secret:       []byte(JIRA_WEBHOOK_SECRET),
+					IssueNumber:  tracker.IssueNumber,
+					Pipeline:     pipeline,
+					IgnoreActors: []string{self.AccountID},
+				},
+				run: pipeline.Run,
+			})
 		}
-	}()
-	return issueCh
-}
 
-func createJiraIssue(jiraClient *jira.Client, issue GithubIssue) (*jira.Issue, error) {
-	i := jira.Issue{
-		Fields: &jira.IssueFields{
-			Description: fmt.Sprintf("Originally posted on Github: %s\n\n%s", issue.URL, issue.Body),
-			Type: jira.IssueType{
-				Name: "Task",
+		if err := serveForever(ctx, listenAddr, &daemon.Scheduler{
+			Sync: func(ctx context.Context) error {
+				_, err := runOnce(ctx)
+				return err
 			},
-			Project: jira.Project{
-				Key: "OSASINFRA",
-			},
-			Summary:    "GH-orc-" + strconv.Itoa(issue.Number) + ": " + issue.Title,
-			Components: []*jira.Component{{Name: "ORC"}},
-		},
-	}
-
-	if assignee := issue.Assignee.JiraAccountID; assignee != "" {
-		i.Fields.Assignee = &jira.User{
-			AccountID: assignee,
+			Interval: interval,
+			Jitter:   jitter,
+		}, endpoints...); err != nil {
+			fatal(exitFatal, "Unable to serve", "error", err)
 		}
+		return
 	}
 
-	if author := issue.Author.JiraAccountID; author != "" {
-		i.Fields.Reporter = &jira.User{
-			AccountID: author,
-		}
+	result, err := runOnce(ctx)
+	if err != nil {
+		os.Exit(exitFatal)
+	}
+	if len(result.Failures) > 0 {
+		os.Exit(exitPartial)
 	}
+}
 
-	jiraIssue, response, err := jiraClient.Issue.Create(&i)
-	if err != nil {
-		io.Copy(os.Stderr, response.Body)
-		log.Println()
-		return nil, err
+// observeSync records the outcome of a single-issue sync in the metrics. A
+// sync that could not complete counts as a failed issue.
+func observeSync(result reconcile.Result, err error) {
+	failed := len(result.Failures)
+	if err != nil && failed == 0 {
+		failed = 1
 	}
+	metrics.ObserveSync(metrics.Run{
+		Seen:         result.Seen,
+		Created:      len(result.Created),
+		Transitioned: len(result.Transitioned),
+		Updated:      len(result.Updated),
+		Skipped:      len(result.Skipped),
+		Failed:       failed,
+	})
+}
 
-	return jiraIssue, nil
+// newTracker returns the Jira tracker of the mirrored issues.
+func newTracker(client *jira.Client) *jiratracker.Tracker {
+	return &jiratracker.Tracker{
+		Client:        client,
+		JQL:           shiftStackQuery,
+		Project:       "OSASINFRA",
+		Component:     "ORC",
+		SummaryPrefix: "GH-orc-",
+	}
 }
 
-type knownIssue struct {
-	Key    string
-	Status *jira.Status
+// endpoint is an HTTP handler served by "ghira serve", with the worker that
+// processes what it receives. Workers that don't receive anything have no
+// pattern and no handler.
+type endpoint struct {
+	pattern string
+	handler http.Handler
+	run     func(ctx context.Context)
 }
 
-func main() {
-	ctx := context.Background()
+// serveForever serves the health and metrics endpoints and the additional
+// endpoints on addr, and runs the scheduler and the endpoint workers until
+// ctx is cancelled.
+func serveForever(ctx context.Context, addr string, scheduler *daemon.Scheduler, endpoints ...endpoint) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", scheduler.Healthz)
+	mux.HandleFunc("GET /readyz", scheduler.Readyz)
+	mux.Handle("GET /metrics", metrics.Handler())
+	for _, e := range endpoints {
+		if e.handler != nil {
+			mux.Handle(e.pattern, e.handler)
+		}
+	}
 
-	people, err := team.Load(strings.NewReader(PEOPLE))
-	if err != nil {
-		log.Fatalf("error fetching team information: %v", err)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	jiraClient, err := jiraclient.NewWithToken(query.JiraBaseURL, JIRA_EMAIL, JIRA_TOKEN)
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
-		log.Fatalf("error building a Jira client: %v", err)
+		return err
 	}
+	slog.Info("Listening", "addr", addr)
+	scheduler.SetReady()
 
-	issues := fetchGitHubIssues(ctx, GITHUB_TOKEN)
-
-	alreadyKnown := make(map[int]knownIssue)
-	for issue := range query.SearchIssues(ctx, jiraClient, shiftStackQuery) {
-		if s := ghIssueNumberRegex.FindStringSubmatch(issue.Fields.Summary); len(s) > 1 {
-			n, err := strconv.Atoi(s[1])
-			if err != nil {
-				panic("unexpected error: could not parse the issue number: " + err.Error())
-			}
-			alreadyKnown[n] = knownIssue{
-				Key:    issue.Key,
-				Status: issue.Fields.Status,
-			}
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			serveErr <- err
 		}
-	}
+		close(serveErr)
+	}()
 
-	{
-		alreadyKnownNumbers := make([]string, 0, len(alreadyKnown))
-		for k := range alreadyKnown {
-			alreadyKnownNumbers = append(alreadyKnownNumbers, strconv.Itoa(k))
-		}
-		log.Printf("Known issues: %v", alreadyKnownNumbers)
+	workersCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scheduler.Run(workersCtx)
+	}()
+	for _, e := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.run(workersCtx)
+		}()
 	}
 
-	for issue := range ResolveNames(issues, people) {
-		jiraIssue, issueExistsInJira := alreadyKnown[issue.Number]
-		log.Printf("Now processing Github issue number %d, assigned to %s, status %q (Jira: %q)", issue.Number, issue.Author.Handle, issue.Status, jiraIssue.Key)
-
-		if issueExistsInJira {
-			var transitionTodo, transitionClosed string
-			{
-				possibleTransitions, _, err := jiraClient.Issue.GetTransitions(jiraIssue.Key)
-				if err != nil {
-					log.Printf("ERROR: Unable to get transitions for issue %s: %v", jiraIssue.Key, err)
-				}
-
-				var transitionNames []string
-				for _, v := range possibleTransitions {
-					transitionNames = append(transitionNames, v.Name)
-					switch v.Name {
-					case "Closed":
-						transitionClosed = v.ID
-					case "To Do":
-						transitionTodo = v.ID
-					}
-				}
-			}
-
-			switch {
-			case issue.Status == "closed" && jiraIssue.Status.Name != "Closed":
-				if transitionClosed == "" {
-					log.Printf("WARNING: No \"Closed\" transition available for %s -- skipping", jiraIssue.Key)
-				} else if _, err := jiraClient.Issue.DoTransition(jiraIssue.Key, transitionClosed); err != nil {
-					log.Printf("ERROR: Unable to transition issue %s to Closed: %v", jiraIssue.Key, err)
-				} else {
-					log.Printf("Transitioned issue %s to Closed", jiraIssue.Key)
-				}
-			case issue.Status == "open" && jiraIssue.Status.Name == "Closed":
-				if transitionTodo == "" {
-					log.Printf("WARNING: No \"To Do\" transition available for %s -- skipping", jiraIssue.Key)
-				} else if _, err := jiraClient.Issue.DoTransition(jiraIssue.Key, transitionTodo); err != nil {
-					log.Printf("ERROR: Unable to transition issue %s to To Do: %v", jiraIssue.Key, err)
-				} else {
-					log.Printf("Transitioned issue %s to To Do", jiraIssue.Key)
-				}
-			}
-		} else {
-			jiraIssue, err := createJiraIssue(jiraClient, issue)
-			if err != nil {
-				fmt.Println("Error creating Jira issue:", err)
-			}
+	select {
+	case <-ctx.Done():
+	case err = <-serveErr:
+		// Stop the workers if the server failed to start.
+		cancel()
+	}
+	wg.Wait()
 
-			if jiraIssue != nil {
-				log.Printf("Created Jira task with key: %s", jiraIssue.Key)
-			}
-		}
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if shutdownErr := server.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
 	}
+	return err
 }
 
-func init() {
-	log.SetFlags(log.Ldate | log.Ltime | log.LUTC)
-
+// checkEnvironment exits if a required environment variable is missing.
+func checkEnvironment() {
 	ex_usage := false
 	if GITHUB_TOKEN == "" {
 		ex_usage = true
-		log.Print("Required environment variable not found: GITHUB_TOKEN")
+		slog.Error("Required environment variable not found", "variable", "GITHUB_TOKEN")
 	}
 
 	if JIRA_EMAIL == "" {
 		ex_usage = true
-		log.Print("Required environment variable not found: JIRA_EMAIL")
+		slog.Error("Required environment variable not found", "variable", "JIRA_EMAIL")
 	}
 
 	if JIRA_TOKEN == "" {
 		ex_usage = true
-		log.Print("Required environment variable not found: JIRA_TOKEN")
+		slog.Error("Required environment variable not found", "variable", "JIRA_TOKEN")
 	}
 
 	if PEOPLE == "" {
 		ex_usage = true
-		log.Print("Required environment variable not found: PEOPLE")
+		slog.Error("Required environment variable not found", "variable", "PEOPLE")
 	}
 
 	if ex_usage {
-		log.Print("Exiting.")
-		os.Exit(64)
+		fatal(exitUsage, "Exiting.")
 	}
 }
@@ -0,0 +1,204 @@
+// Package config loads the optional ghira configuration file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the content of the configuration file. The zero value is a
+// valid configuration, which disables all the optional behaviours.
+type Config struct {
+	Reverse Reverse `yaml:"reverse"`
+
+	// Fields declares which side owns each field of the mirrored issues,
+	// indexed by field name. The fields that are not listed are not
+	// synced after the Jira issue is created, except for the status,
+	// which is owned by Github.
+	Fields map[string]Owner `yaml:"fields"`
+
+	// Orphans configures what is done to the Jira issues whose Github
+	// issue was deleted. Without it, they are only reported.
+	Orphans *Orphans `yaml:"orphans"`
+}
+
+// Orphans configures the handling of the Jira issues whose Github issue was
+// deleted. It is applied once to each issue.
+type Orphans struct {
+	// Comment is posted on the Jira issue, unless empty.
+	Comment string `yaml:"comment"`
+
+	// Label is added to the Jira issue, unless empty.
+	Label string `yaml:"label"`
+
+	// Close closes the Jira issue.
+	Close bool `yaml:"close"`
+}
+
+// Owner is the side whose value of a field wins.
+type Owner string
+
+const (
+	// OwnerGithub copies the Github value to Jira, and reverts the changes
+	// made in Jira.
+	OwnerGithub Owner = "github"
+
+	// OwnerJira copies the Jira value to Github, and reverts the changes
+	// made in Github.
+	OwnerJira Owner = "jira"
+
+	// OwnerLastWriter copies the value from the side where it last
+	// changed.
+	OwnerLastWriter Owner = "last-writer-wins"
+)
+
+// FieldNames are the fields that can be synced.
+var FieldNames = []string{"summary", "description", "assignee", "status", "labels", "fixVersion"}
+
+var owners = []Owner{OwnerGithub, OwnerJira, OwnerLastWriter}
+
+// Reverse configures the reverse sync, from Jira to Github.
+type Reverse struct {
+	// Close lists the rules that close the Github issue when its Jira
+	// issue reaches a status of the "done" category. The first rule
+	// matching the Jira resolution applies.
+	Close []CloseRule `yaml:"close"`
+
+	// Reopen reopens the Github issue when its Jira issue leaves the
+	// "done" category.
+	Reopen *ReopenRule `yaml:"reopen"`
+
+	// Assignee assigns the Github issue to the team member its Jira issue
+	// is assigned to.
+	Assignee bool `yaml:"assignee"`
+}
+
+// Status reports whether the reverse sync closes or reopens the Github
+// issues, with its own rules.
+func (r Reverse) Status() bool {
+	return len(r.Close) > 0 || r.Reopen != nil
+}
+
+// CloseRule maps Jira resolutions to a Github state reason.
+type CloseRule struct {
+	// Resolutions are the names of the Jira resolutions the rule applies
+	// to. Empty matches any resolution.
+	Resolutions []string `yaml:"resolutions"`
+
+	// StateReason is the Github state reason: "completed", "not_planned"
+	// or "duplicate".
+	StateReason string `yaml:"state_reason"`
+
+	// Comment is posted on the Github issue when closing it. It is a
+	// text/template executed with the fields Key, URL, Status and
+	// Resolution of the Jira issue. Defaults to DefaultCloseComment.
+	Comment string `yaml:"comment"`
+}
+
+// ReopenRule configures the reopening of Github issues.
+type ReopenRule struct {
+	// Comment is posted on the Github issue when reopening it, as for
+	// CloseRule. Defaults to DefaultReopenComment.
+	Comment string `yaml:"comment"`
+}
+
+const (
+	DefaultCloseComment  = "The Jira issue [{{.Key}}]({{.URL}}) was closed as {{.Resolution}}: closing."
+	DefaultReopenComment = "The Jira issue [{{.Key}}]({{.URL}}) was moved back to {{.Status}}: reopening."
+)
+
+var stateReasons = []string{"completed", "not_planned", "duplicate"}
+
+// Matches reports whether the rule applies to a Jira resolution.
+func (r CloseRule) Matches(resolution string) bool {
+	return len(r.Resolutions) == 0 || slices.Contains(r.Resolutions, resolution)
+}
+
+// Load reads the configuration file at path.
+func Load(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+
+	config, err := Parse(f)
+	if err != nil {
+		return Config{}, fmt.Errorf("error loading %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Parse decodes and validates a configuration. Unknown keys are rejected.
+func Parse(r io.Reader) (Config, error) {
+	var config Config
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, err
+	}
+	return config, config.validate()
+}
+
+func (c *Config) validate() error {
+	for field, owner := range c.Fields {
+		if !slices.Contains(FieldNames, field) {
+			return fmt.Errorf("fields: unknown field %q: must be one of %q", field, FieldNames)
+		}
+		if !slices.Contains(owners, owner) {
+			return fmt.Errorf("fields.%s: invalid owner %q: must be one of %q", field, owner, owners)
+		}
+	}
+	// The Jira description is the text rendering of the Markdown body of
+	// the Github issue, which can't be written back.
+	if owner, ok := c.Fields["description"]; ok && owner != OwnerGithub {
+		return fmt.Errorf("fields.description: invalid owner %q: the description can only be owned by Github", owner)
+	}
+	statusOwner, ok := c.Fields["status"]
+	if !ok {
+		statusOwner = OwnerGithub
+	}
+	if statusOwner == OwnerGithub && c.Reverse.Status() {
+		return fmt.Errorf("reverse.close and reverse.reopen can't be set when the status is owned by Github")
+	}
+	if c.Fields["assignee"] == OwnerGithub && c.Reverse.Assignee {
+		return fmt.Errorf("reverse.assignee can't be set when the assignee is owned by Github")
+	}
+
+	if o := c.Orphans; o != nil {
+		if o.Comment == "" && o.Label == "" && !o.Close {
+			return fmt.Errorf("orphans: set at least one of comment, label and close")
+		}
+		if strings.ContainsAny(o.Label, " \t\n") {
+			return fmt.Errorf("orphans.label: invalid label %q: Jira labels can't contain spaces", o.Label)
+		}
+	}
+
+	for i, rule := range c.Reverse.Close {
+		if !slices.Contains(stateReasons, rule.StateReason) {
+			return fmt.Errorf("reverse.close[%d]: invalid state_reason %q: must be one of %q", i, rule.StateReason, stateReasons)
+		}
+		if rule.Comment == "" {
+			c.Reverse.Close[i].Comment = DefaultCloseComment
+		}
+		if _, err := template.New("").Parse(c.Reverse.Close[i].Comment); err != nil {
+			return fmt.Errorf("reverse.close[%d]: invalid comment: %w", i, err)
+		}
+	}
+	if reopen := c.Reverse.Reopen; reopen != nil {
+		if reopen.Comment == "" {
+			reopen.Comment = DefaultReopenComment
+		}
+		if _, err := template.New("").Parse(reopen.Comment); err != nil {
+			return fmt.Errorf("reverse.reopen: invalid comment: %w", err)
+		}
+	}
+	return nil
+}
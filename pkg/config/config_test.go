@@ -0,0 +1,181 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shiftstack/ghira/pkg/config"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range [...]struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{
+			name: "empty",
+			in:   "",
+		},
+		{
+			name: "reverse rules",
+			in: `
+fields:
+  status: jira
+reverse:
+  close:
+    - resolutions: ["Won't Do", "Obsolete"]
+      state_reason: not_planned
+    - state_reason: completed
+      comment: "Done in {{.Key}}"
+  reopen: {}
+`,
+		},
+		{
+			name: "fields",
+			in: `
+fields:
+  summary: github
+  status: jira
+  labels: last-writer-wins
+reverse:
+  close:
+    - state_reason: completed
+`,
+		},
+		{
+			name: "unknown field",
+			in: `
+fields:
+  priority: jira
+`,
+			wantErr: `unknown field "priority"`,
+		},
+		{
+			name: "invalid owner",
+			in: `
+fields:
+  summary: both
+`,
+			wantErr: `invalid owner "both"`,
+		},
+		{
+			name: "reverse status sync of a Github-owned status",
+			in: `
+fields:
+  status: github
+reverse:
+  reopen: {}
+`,
+			wantErr: "owned by Github",
+		},
+		{
+			name: "reverse status sync of the default status owner",
+			in: `
+reverse:
+  close:
+    - state_reason: completed
+`,
+			wantErr: "owned by Github",
+		},
+		{
+			name: "description owned by Jira",
+			in: `
+fields:
+  description: jira
+`,
+			wantErr: "can only be owned by Github",
+		},
+		{
+			name: "orphans",
+			in: `
+orphans:
+  comment: The Github issue was deleted.
+  label: gh-deleted
+  close: true
+`,
+		},
+		{
+			name: "orphans without action",
+			in: `
+orphans: {}
+`,
+			wantErr: "set at least one of",
+		},
+		{
+			name: "orphans label with spaces",
+			in: `
+orphans:
+  label: gh deleted
+`,
+			wantErr: `invalid label "gh deleted"`,
+		},
+		{
+			name: "unknown key",
+			in: `
+reverse:
+  clsoe: []
+`,
+			wantErr: "field clsoe not found",
+		},
+		{
+			name: "invalid state reason",
+			in: `
+fields:
+  status: jira
+reverse:
+  close:
+    - state_reason: wontfix
+`,
+			wantErr: `invalid state_reason "wontfix"`,
+		},
+		{
+			name: "invalid template",
+			in: `
+fields:
+  status: jira
+reverse:
+  close:
+    - state_reason: completed
+      comment: "{{.Key"
+`,
+			wantErr: "invalid comment",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := config.Parse(strings.NewReader(tc.in))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseDefaults(t *testing.T) {
+	c, err := config.Parse(strings.NewReader(`
+fields:
+  status: jira
+reverse:
+  close:
+    - state_reason: completed
+  reopen: {}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Reverse.Close[0].Comment; got != config.DefaultCloseComment {
+		t.Errorf("expected the default close comment, got %q", got)
+	}
+	if got := c.Reverse.Reopen.Comment; got != config.DefaultReopenComment {
+		t.Errorf("expected the default reopen comment, got %q", got)
+	}
+	if !c.Reverse.Close[0].Matches("anything") {
+		t.Errorf("expected a rule without resolutions to match any resolution")
+	}
+}
@@ -0,0 +1,98 @@
+// Package daemon runs the reconciliation on a schedule, for the long-running
+// mode.
+package daemon
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Scheduler calls Sync every Interval, plus a random delay of up to Jitter so
+// that several instances don't hit the APIs at the same time. Runs never
+// overlap.
+type Scheduler struct {
+	// Sync runs one reconciliation. It returns an error if the run could
+	// not complete.
+	Sync func(ctx context.Context) error
+
+	Interval time.Duration
+	Jitter   time.Duration
+
+	// running is held for the duration of a run.
+	running sync.Mutex
+
+	// ready is set once the daemon serves its endpoints.
+	ready atomic.Bool
+}
+
+// Run syncs immediately, then on schedule until ctx is cancelled. A run in
+// progress when ctx is cancelled receives the cancellation and is waited
+// for.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		s.TrySync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		wait := s.Interval
+		if s.Jitter > 0 {
+			wait += rand.N(s.Jitter)
+		}
+		slog.Info("Next run scheduled", "in", wait.Round(time.Second))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// TrySync runs Sync, unless a run is already in progress. It reports whether
+// it ran.
+func (s *Scheduler) TrySync(ctx context.Context) bool {
+	if !s.running.TryLock() {
+		slog.Warn("A run is already in progress: skipping")
+		return false
+	}
+	defer s.running.Unlock()
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	// The failed runs are reported by the metrics and the logs: they
+	// don't make the daemon unready, as it can still receive webhooks.
+	s.Sync(ctx)
+	return true
+}
+
+// Healthz reports that the process is alive.
+func (s *Scheduler) Healthz(w http.ResponseWriter, _ *http.Request) {
+	io.WriteString(w, "ok\n")
+}
+
+// SetReady marks the daemon as ready, once its configuration is loaded and
+// its HTTP server listens.
+func (s *Scheduler) SetReady() {
+	s.ready.Store(true)
+}
+
+// Readyz reports whether the daemon is ready to serve. The outcome of the
+// runs doesn't affect it.
+func (s *Scheduler) Readyz(w http.ResponseWriter, _ *http.Request) {
+	if !s.ready.Load() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
@@ -0,0 +1,80 @@
+package daemon_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shiftstack/ghira/pkg/daemon"
+)
+
+func readyz(s *daemon.Scheduler) int {
+	rec := httptest.NewRecorder()
+	s.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	return rec.Code
+}
+
+func TestSchedulerTrySync(t *testing.T) {
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+		runErr  error
+	)
+	s := &daemon.Scheduler{
+		Sync: func(context.Context) error {
+			started <- struct{}{}
+			<-release
+			return runErr
+		},
+	}
+
+	if code := readyz(s); code != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready before SetReady, got %d", code)
+	}
+	s.SetReady()
+
+	done := make(chan bool)
+	go func() { done <- s.TrySync(context.Background()) }()
+	<-started
+
+	if s.TrySync(context.Background()) {
+		t.Errorf("expected no overlapping run")
+	}
+
+	release <- struct{}{}
+	if !<-done {
+		t.Errorf("expected the first run to run")
+	}
+	if code := readyz(s); code != http.StatusOK {
+		t.Errorf("expected ready after a completed run, got %d", code)
+	}
+
+	runErr = errors.New("boom")
+	go func() { done <- s.TrySync(context.Background()) }()
+	<-started
+	release <- struct{}{}
+	<-done
+	if code := readyz(s); code != http.StatusOK {
+		t.Errorf("expected still ready after a failed run, got %d", code)
+	}
+}
+
+func TestSchedulerRunStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var runs int
+	s := &daemon.Scheduler{
+		Sync: func(context.Context) error {
+			runs++
+			cancel()
+			return nil
+		},
+		Interval: 1,
+	}
+
+	s.Run(ctx)
+	if runs != 1 {
+		t.Errorf("expected 1 run, got %d", runs)
+	}
+}
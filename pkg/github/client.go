@@ -0,0 +1,24 @@
+package github
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/httpcache"
+	"github.com/shiftstack/ghira/pkg/metrics"
+	"github.com/shiftstack/ghira/pkg/retry"
+)
+
+// NewHTTPClient returns the HTTP client used for all Github requests. It waits
+// out rate limits and retries transient errors; each attempt is bounded by
+// timeout, unless it is zero. If cacheDir is not empty, responses are cached
+// there and revalidated with conditional requests.
+func NewHTTPClient(cacheDir string, timeout time.Duration) *http.Client {
+	var transport http.RoundTripper = &metrics.Transport{Service: "Github"}
+	if cacheDir != "" {
+		transport = &httpcache.Transport{Dir: cacheDir, Transport: transport}
+	}
+	return &http.Client{
+		Transport: &retry.Transport{Name: "Github", Transport: transport, Timeout: timeout},
+	}
+}
@@ -0,0 +1,349 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const githubGraphQLURL = "https://api.github.com/graphql"
+
+// issueFields are the fields of an issue that ghira syncs, so that one
+// request replaces several REST calls per issue. Comments that don't fit in
+// the first page are fetched with commentsQuery.
+//
+// https://docs.github.com/en/graphql/reference/objects#issue
+const issueFields = `
+        number
+        title
+        bodyText
+        url
+        state
+        stateReason
+        author { login }
+        assignees(first: 20) { nodes { login } }
+        labels(first: 50) { nodes { name } }
+        milestone { number title }
+        comments(first: 50) {
+          pageInfo { hasNextPage endCursor }
+          nodes { author { login } bodyText url createdAt }
+        }
+        closedByPullRequestsReferences(first: 20, includeClosedPrs: true) {
+          nodes { number url state }
+        }`
+
+// issuesQuery fetches a page of issues together with their related data.
+const issuesQuery = `query($owner: String!, $name: String!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    issues(first: 50, after: $cursor, orderBy: {field: CREATED_AT, direction: DESC}) {
+      pageInfo { hasNextPage endCursor }
+      nodes {` + issueFields + `
+      }
+    }
+  }
+}`
+
+// issueQuery fetches a single issue together with its related data.
+const issueQuery = `query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    issue(number: $number) {` + issueFields + `
+    }
+  }
+}`
+
+const commentsQuery = `query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    issue(number: $number) {
+      comments(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes { author { login } bodyText url createdAt }
+      }
+    }
+  }
+}`
+
+type graphQLPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type graphQLActor struct {
+	Login string `json:"login"`
+}
+
+type graphQLComments struct {
+	PageInfo graphQLPageInfo `json:"pageInfo"`
+	Nodes    []struct {
+		Author    *graphQLActor `json:"author"`
+		BodyText  string        `json:"bodyText"`
+		URL       string        `json:"url"`
+		CreatedAt time.Time     `json:"createdAt"`
+	} `json:"nodes"`
+}
+
+func (c graphQLComments) toGithub() []Comment {
+	comments := make([]Comment, 0, len(c.Nodes))
+	for _, n := range c.Nodes {
+		comment := Comment{
+			Body:      n.BodyText,
+			URL:       n.URL,
+			CreatedAt: n.CreatedAt,
+		}
+		// The author is null for deleted accounts
+		if n.Author != nil {
+			comment.Author.Handle = n.Author.Login
+		}
+		comments = append(comments, comment)
+	}
+	return comments
+}
+
+type graphQLIssue struct {
+	Number      int           `json:"number"`
+	Title       string        `json:"title"`
+	BodyText    string        `json:"bodyText"`
+	URL         string        `json:"url"`
+	State       string        `json:"state"`
+	StateReason string        `json:"stateReason"`
+	Author      *graphQLActor `json:"author"`
+	Assignees   struct {
+		Nodes []graphQLActor `json:"nodes"`
+	} `json:"assignees"`
+	Labels struct {
+		Nodes []Label `json:"nodes"`
+	} `json:"labels"`
+	Milestone                      *Milestone      `json:"milestone"`
+	Comments                       graphQLComments `json:"comments"`
+	ClosedByPullRequestsReferences struct {
+		Nodes []struct {
+			Number int    `json:"number"`
+			URL    string `json:"url"`
+			State  string `json:"state"`
+		} `json:"nodes"`
+	} `json:"closedByPullRequestsReferences"`
+}
+
+// toGithub converts the GraphQL representation to the model shared with the
+// REST backend. Enum values are lowercased to match REST.
+func (i graphQLIssue) toGithub() Issue {
+	issue := Issue{
+		Title:       i.Title,
+		Body:        i.BodyText,
+		URL:         i.URL,
+		Number:      i.Number,
+		Status:      strings.ToLower(i.State),
+		StateReason: strings.ToLower(i.StateReason),
+		Labels:      i.Labels.Nodes,
+		Milestone:   i.Milestone,
+		Comments:    i.Comments.toGithub(),
+	}
+	if i.Author != nil {
+		issue.Author.Handle = i.Author.Login
+	}
+	for _, a := range i.Assignees.Nodes {
+		issue.Assignees = append(issue.Assignees, User{Handle: a.Login})
+	}
+	if len(issue.Assignees) > 0 {
+		issue.Assignee.Handle = issue.Assignees[0].Handle
+	}
+	for _, pr := range i.ClosedByPullRequestsReferences.Nodes {
+		issue.LinkedPRs = append(issue.LinkedPRs, PullRequest{
+			Number: pr.Number,
+			URL:    pr.URL,
+			State:  strings.ToLower(pr.State),
+		})
+	}
+	return issue
+}
+
+// graphQL runs a query against the Github GraphQL API and decodes the "data"
+// member of the response into data.
+func graphQL(ctx context.Context, client *http.Client, token, query string, variables map[string]any, data any) error {
+	body, err := json.Marshal(map[string]any{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, githubGraphQLURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	// Queries are safe to repeat. The nil value marks the request as
+	// idempotent for retries without sending the header.
+	req.Header["X-Idempotency-Key"] = nil
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if statusCode := res.StatusCode; statusCode != 200 {
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("status code %d from Github. Additionally, reading the body errored with: %v", statusCode, err)
+		}
+		return fmt.Errorf("status code %d from Github: %s", statusCode, body)
+	}
+
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return fmt.Errorf("error decoding the GraphQL response: %w", err)
+	}
+	if len(response.Errors) > 0 {
+		messages := make([]string, 0, len(response.Errors))
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("GraphQL errors: %s", strings.Join(messages, "; "))
+	}
+	return json.Unmarshal(response.Data, data)
+}
+
+// GraphQL fetches issues with the Github GraphQL API. On top of what the REST
+// listing returns, it populates the comments and the linked pull requests of
+// each issue.
+type GraphQL struct {
+	Client     *http.Client
+	Token      string
+	Repository string
+}
+
+// Issues streams the issues of the repository.
+//
+// The error channel receives at most one error and is closed before the
+// issue channel, so that it can be read once the issue channel is drained.
+func (s *GraphQL) Issues(ctx context.Context) (<-chan Issue, <-chan error) {
+	issueCh := make(chan Issue)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(issueCh)
+		defer close(errCh)
+
+		owner, name, _ := strings.Cut(s.Repository, "/")
+
+		var cursor *string
+		for {
+			var data struct {
+				Repository struct {
+					Issues struct {
+						PageInfo graphQLPageInfo `json:"pageInfo"`
+						Nodes    []graphQLIssue  `json:"nodes"`
+					} `json:"issues"`
+				} `json:"repository"`
+			}
+			if err := graphQL(ctx, s.Client, s.Token, issuesQuery, map[string]any{
+				"owner":  owner,
+				"name":   name,
+				"cursor": cursor,
+			}, &data); err != nil {
+				errCh <- fmt.Errorf("error fetching issues: %w", err)
+				return
+			}
+
+			for _, node := range data.Repository.Issues.Nodes {
+				issue := node.toGithub()
+				if node.Comments.PageInfo.HasNextPage {
+					more, err := fetchRemainingComments(ctx, s.Client, s.Token, owner, name, node.Number, node.Comments.PageInfo.EndCursor)
+					if err != nil {
+						errCh <- fmt.Errorf("error fetching comments of issue %d: %w", node.Number, err)
+						return
+					}
+					issue.Comments = append(issue.Comments, more...)
+				}
+				select {
+				case issueCh <- issue:
+				case <-ctx.Done():
+					errCh <- ctx.Err()
+					return
+				}
+			}
+
+			pageInfo := data.Repository.Issues.PageInfo
+			if !pageInfo.HasNextPage {
+				break
+			}
+			cursor = &pageInfo.EndCursor
+		}
+	}()
+	return issueCh, errCh
+}
+
+// Issue fetches a single issue.
+func (s *GraphQL) Issue(ctx context.Context, number int) (Issue, error) {
+	owner, name, _ := strings.Cut(s.Repository, "/")
+
+	var data struct {
+		Repository struct {
+			Issue *graphQLIssue `json:"issue"`
+		} `json:"repository"`
+	}
+	if err := graphQL(ctx, s.Client, s.Token, issueQuery, map[string]any{
+		"owner":  owner,
+		"name":   name,
+		"number": number,
+	}, &data); err != nil {
+		return Issue{}, fmt.Errorf("error fetching issue %d: %w", number, err)
+	}
+
+	node := data.Repository.Issue
+	if node == nil {
+		return Issue{}, fmt.Errorf("issue %d not found", number)
+	}
+	issue := node.toGithub()
+	if node.Comments.PageInfo.HasNextPage {
+		more, err := fetchRemainingComments(ctx, s.Client, s.Token, owner, name, node.Number, node.Comments.PageInfo.EndCursor)
+		if err != nil {
+			return Issue{}, fmt.Errorf("error fetching comments of issue %d: %w", node.Number, err)
+		}
+		issue.Comments = append(issue.Comments, more...)
+	}
+	return issue, nil
+}
+
+func fetchRemainingComments(ctx context.Context, client *http.Client, token, owner, name string, number int, cursor string) ([]Comment, error) {
+	var comments []Comment
+	for {
+		var data struct {
+			Repository struct {
+				Issue struct {
+					Comments graphQLComments `json:"comments"`
+				} `json:"issue"`
+			} `json:"repository"`
+		}
+		if err := graphQL(ctx, client, token, commentsQuery, map[string]any{
+			"owner":  owner,
+			"name":   name,
+			"number": number,
+			"cursor": cursor,
+		}, &data); err != nil {
+			return nil, err
+		}
+
+		page := data.Repository.Issue.Comments
+		comments = append(comments, page.toGithub()...)
+		if !page.PageInfo.HasNextPage {
+			return comments, nil
+		}
+		cursor = page.PageInfo.EndCursor
+	}
+}
@@ -0,0 +1,56 @@
+// Package github fetches issues from a Github repository.
+package github
+
+import "time"
+
+type Issue struct {
+	Title  string `json:"title"`
+	Body   string `json:"body_text"`
+	URL    string `json:"html_url"`
+	Number int    `json:"number"`
+	Author struct {
+		Handle        string `json:"login"`
+		JiraAccountID string `json:"-"`
+	} `json:"user"`
+	Assignee struct {
+		Handle        string `json:"login"`
+		JiraAccountID string `json:"-"`
+	} `json:"assignee"`
+	Status      string     `json:"state"`
+	StateReason string     `json:"state_reason"`
+	Assignees   []User     `json:"assignees"`
+	Labels      []Label    `json:"labels"`
+	Milestone   *Milestone `json:"milestone"`
+	IsPR        any        `json:"pull_request"`
+
+	// Comments and LinkedPRs are only populated by the GraphQL backend.
+	Comments  []Comment     `json:"-"`
+	LinkedPRs []PullRequest `json:"-"`
+}
+
+type User struct {
+	Handle string `json:"login"`
+}
+
+type Label struct {
+	Name string `json:"name"`
+}
+
+type Milestone struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+}
+
+type Comment struct {
+	Author    User      `json:"user"`
+	Body      string    `json:"body_text"`
+	URL       string    `json:"html_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PullRequest is a pull request that closes an issue when merged.
+type PullRequest struct {
+	Number int    `json:"number"`
+	URL    string `json:"html_url"`
+	State  string `json:"state"`
+}
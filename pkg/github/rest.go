@@ -0,0 +1,404 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var linkHeaderRegex = regexp.MustCompile(`<(\S+)>; rel="next"`)
+
+// REST fetches issues with the Github REST API.
+type REST struct {
+	Client     *http.Client
+	Token      string
+	Repository string
+}
+
+// Issues streams the issues of the repository, excluding pull requests.
+//
+// The error channel receives at most one error and is closed before the
+// issue channel, so that it can be read once the issue channel is drained.
+func (s *REST) Issues(ctx context.Context) (<-chan Issue, <-chan error) {
+	issueCh := make(chan Issue)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(issueCh)
+		defer close(errCh)
+
+		// https://docs.github.com/en/rest/issues/issues?apiVersion=2022-11-28#list-repository-issues
+		url := fmt.Sprintf("https://api.github.com/repos/%s/issues", s.Repository)
+		for url != "" {
+			issueBatch, next, err := s.fetchPage(ctx, url)
+			if err != nil {
+				errCh <- fmt.Errorf("error fetching issues: %w", err)
+				return
+			}
+			for _, issue := range issueBatch {
+				if issue.IsPR != nil {
+					continue
+				}
+				select {
+				case issueCh <- issue:
+				case <-ctx.Done():
+					errCh <- ctx.Err()
+					return
+				}
+			}
+			url = next
+		}
+	}()
+	return issueCh, errCh
+}
+
+// Issue fetches a single issue. It returns an error if number is a pull
+// request.
+func (s *REST) Issue(ctx context.Context, number int) (Issue, error) {
+	// https://docs.github.com/en/rest/issues/issues?apiVersion=2022-11-28#get-an-issue
+	var issue Issue
+	if _, err := s.get(ctx, fmt.Sprintf("https://api.github.com/repos/%s/issues/%d", s.Repository, number), nil, &issue); err != nil {
+		return Issue{}, fmt.Errorf("error fetching issue %d: %w", number, err)
+	}
+	if issue.IsPR != nil {
+		return Issue{}, fmt.Errorf("#%d is a pull request", number)
+	}
+	return issue, nil
+}
+
+// fetchPage returns the issues at url, and the URL of the next page if any.
+func (s *REST) fetchPage(ctx context.Context, url string) ([]Issue, string, error) {
+	var issueBatch []Issue
+	header, err := s.get(ctx, url, neturl.Values{"state": {"all"}}, &issueBatch)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return issueBatch, nextPage(header), nil
+}
+
+// nextPage returns the URL of the next page of a listing, if any.
+func nextPage(header http.Header) string {
+	if linkHeader := header.Get("link"); linkHeader != "" {
+		if s := linkHeaderRegex.FindStringSubmatch(linkHeader); len(s) > 1 {
+			return s[1]
+		}
+	}
+	return ""
+}
+
+// getAll decodes all the pages of the listing at url.
+func getAll[T any](ctx context.Context, s *REST, url string, query neturl.Values) ([]T, error) {
+	var all []T
+	for url != "" {
+		var page []T
+		header, err := s.get(ctx, url, query, &page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		// The URL of the next page holds the query.
+		url, query = nextPage(header), nil
+	}
+	return all, nil
+}
+
+// get decodes the JSON response to a GET request to url into v, and returns
+// the response headers.
+func (s *REST) get(ctx context.Context, url string, query neturl.Values, v any) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.setReadHeaders(req)
+	if query != nil {
+		q := req.URL.Query()
+		for k, values := range query {
+			q[k] = values
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if statusCode := res.StatusCode; statusCode != 200 {
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return nil, fmt.Errorf("status code %d from Github. Additionally, reading the body errored with: %v", statusCode, err)
+		}
+		return nil, fmt.Errorf("status code %d from Github: %s", statusCode, body)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("error decoding the Github response: %w", err)
+	}
+	return res.Header, nil
+}
+
+func (s *REST) setReadHeaders(req *http.Request) {
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		req.Header.Set("Accept", "application/vnd.github.text+json") // Don't need the Markdown version
+	}
+}
+
+// Location is what became of an issue that is missing from the listing of the
+// repository.
+type Location struct {
+	// Moved is the issue it was transferred to, if any.
+	Moved *Issue
+
+	// Gone is set if the issue was deleted, or can't be seen anymore.
+	Gone bool
+}
+
+// Locate looks up an issue that is missing from the listing. Github redirects
+// the requests for a transferred issue to its new location, and answers 404
+// or 410 for a deleted one. The zero Location means that the issue is still
+// in the repository.
+func (s *REST) Locate(ctx context.Context, number int) (Location, error) {
+	// https://docs.github.com/en/rest/issues/issues?apiVersion=2022-11-28#get-an-issue
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://api.github.com/repos/%s/issues/%d", s.Repository, number), nil)
+	if err != nil {
+		return Location{}, err
+	}
+	s.setReadHeaders(req)
+
+	client := *s.Client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	res, err := client.Do(req)
+	if err != nil {
+		return Location{}, fmt.Errorf("error locating issue %d: %w", number, err)
+	}
+	defer func() {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return Location{}, nil
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		url, err := res.Location()
+		if err != nil {
+			return Location{}, fmt.Errorf("error locating issue %d: %w", number, err)
+		}
+		var moved Issue
+		if _, err := s.get(ctx, url.String(), nil, &moved); err != nil {
+			return Location{}, fmt.Errorf("error fetching the transferred issue %d: %w", number, err)
+		}
+		return Location{Moved: &moved}, nil
+	case http.StatusNotFound, http.StatusGone:
+		return Location{Gone: true}, nil
+	default:
+		body, _ := io.ReadAll(res.Body)
+		return Location{}, fmt.Errorf("error locating issue %d: status code %d from Github: %s", number, res.StatusCode, body)
+	}
+}
+
+// SetState closes or reopens an issue. stateReason is only sent when
+// closing.
+func (s *REST) SetState(ctx context.Context, number int, state, stateReason string) error {
+	// https://docs.github.com/en/rest/issues/issues?apiVersion=2022-11-28#update-an-issue
+	update := map[string]string{"state": state}
+	if state == "closed" && stateReason != "" {
+		update["state_reason"] = stateReason
+	}
+	// Setting the state is safe to repeat.
+	if err := s.send(ctx, http.MethodPatch, fmt.Sprintf("https://api.github.com/repos/%s/issues/%d", s.Repository, number), update, true); err != nil {
+		return fmt.Errorf("error setting the state of issue %d: %w", number, err)
+	}
+	return nil
+}
+
+// AddComment posts a comment on an issue.
+func (s *REST) AddComment(ctx context.Context, number int, body string) error {
+	// https://docs.github.com/en/rest/issues/comments?apiVersion=2022-11-28#create-an-issue-comment
+	if err := s.send(ctx, http.MethodPost, fmt.Sprintf("https://api.github.com/repos/%s/issues/%d/comments", s.Repository, number), map[string]string{"body": body}, false); err != nil {
+		return fmt.Errorf("error commenting on issue %d: %w", number, err)
+	}
+	return nil
+}
+
+// AddAssignees adds assignees to an issue.
+func (s *REST) AddAssignees(ctx context.Context, number int, handles ...string) error {
+	// https://docs.github.com/en/rest/issues/assignees?apiVersion=2022-11-28#add-assignees-to-an-issue
+	// Adding an assignee is safe to repeat.
+	if err := s.send(ctx, http.MethodPost, fmt.Sprintf("https://api.github.com/repos/%s/issues/%d/assignees", s.Repository, number), map[string][]string{"assignees": handles}, true); err != nil {
+		return fmt.Errorf("error assigning issue %d: %w", number, err)
+	}
+	return nil
+}
+
+// RemoveAssignees removes assignees from an issue.
+func (s *REST) RemoveAssignees(ctx context.Context, number int, handles ...string) error {
+	// https://docs.github.com/en/rest/issues/assignees?apiVersion=2022-11-28#remove-assignees-from-an-issue
+	if err := s.send(ctx, http.MethodDelete, fmt.Sprintf("https://api.github.com/repos/%s/issues/%d/assignees", s.Repository, number), map[string][]string{"assignees": handles}, true); err != nil {
+		return fmt.Errorf("error unassigning issue %d: %w", number, err)
+	}
+	return nil
+}
+
+// IssueUpdate holds the changes to make to an issue. The nil fields are left
+// unchanged.
+type IssueUpdate struct {
+	Title     *string
+	Body      *string
+	State     *string
+	Assignees *[]string
+
+	// Labels are the names of the labels. A name with underscores in
+	// place of spaces, as in Jira, is the existing label with spaces.
+	Labels *[]string
+
+	// Milestone is the title of the milestone. The empty string removes
+	// the milestone.
+	Milestone *string
+}
+
+// UpdateIssue applies an update to an issue.
+func (s *REST) UpdateIssue(ctx context.Context, number int, update IssueUpdate) error {
+	// https://docs.github.com/en/rest/issues/issues?apiVersion=2022-11-28#update-an-issue
+	payload := make(map[string]any)
+	if update.Title != nil {
+		payload["title"] = *update.Title
+	}
+	if update.Body != nil {
+		payload["body"] = *update.Body
+	}
+	if update.State != nil {
+		payload["state"] = *update.State
+	}
+	if update.Assignees != nil {
+		payload["assignees"] = *update.Assignees
+	}
+	if update.Labels != nil {
+		labels, err := s.labelNames(ctx, *update.Labels)
+		if err != nil {
+			return fmt.Errorf("error updating issue %d: %w", number, err)
+		}
+		payload["labels"] = labels
+	}
+	if update.Milestone != nil {
+		if *update.Milestone == "" {
+			payload["milestone"] = nil
+		} else {
+			n, err := s.milestoneNumber(ctx, *update.Milestone)
+			if err != nil {
+				return fmt.Errorf("error updating issue %d: %w", number, err)
+			}
+			payload["milestone"] = n
+		}
+	}
+	// The update sets absolute values: it is safe to repeat.
+	if err := s.send(ctx, http.MethodPatch, fmt.Sprintf("https://api.github.com/repos/%s/issues/%d", s.Repository, number), payload, true); err != nil {
+		return fmt.Errorf("error updating issue %d: %w", number, err)
+	}
+	return nil
+}
+
+// labelNames returns the names of the labels of the repository that have the
+// given names once their spaces are replaced with underscores. The other
+// names are returned unchanged: Github creates the missing labels.
+func (s *REST) labelNames(ctx context.Context, names []string) ([]string, error) {
+	if !slices.ContainsFunc(names, func(name string) bool { return strings.Contains(name, "_") }) {
+		return names, nil
+	}
+	// https://docs.github.com/en/rest/issues/labels?apiVersion=2022-11-28#list-labels-for-a-repository
+	labels, err := getAll[Label](ctx, s, fmt.Sprintf("https://api.github.com/repos/%s/labels", s.Repository), neturl.Values{"per_page": {"100"}})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching labels: %w", err)
+	}
+	byJiraName := make(map[string]string, len(labels))
+	for _, l := range labels {
+		byJiraName[strings.ReplaceAll(l.Name, " ", "_")] = l.Name
+	}
+	mapped := make([]string, 0, len(names))
+	for _, name := range names {
+		if label, ok := byJiraName[name]; ok {
+			name = label
+		}
+		mapped = append(mapped, name)
+	}
+	return mapped, nil
+}
+
+// milestoneNumber returns the number of the milestone with the given title.
+func (s *REST) milestoneNumber(ctx context.Context, title string) (int, error) {
+	// https://docs.github.com/en/rest/issues/milestones?apiVersion=2022-11-28#list-milestones
+	milestones, err := getAll[Milestone](ctx, s, fmt.Sprintf("https://api.github.com/repos/%s/milestones", s.Repository), neturl.Values{"state": {"all"}, "per_page": {"100"}})
+	if err != nil {
+		return 0, fmt.Errorf("error fetching milestones: %w", err)
+	}
+	for _, m := range milestones {
+		if m.Title == title {
+			return m.Number, nil
+		}
+	}
+	return 0, fmt.Errorf("no milestone %q", title)
+}
+
+// Login returns the handle of the user authenticated by the token.
+func (s *REST) Login(ctx context.Context) (string, error) {
+	// https://docs.github.com/en/rest/users/users?apiVersion=2022-11-28#get-the-authenticated-user
+	var user User
+	if _, err := s.get(ctx, "https://api.github.com/user", nil, &user); err != nil {
+		return "", fmt.Errorf("error fetching the authenticated user: %w", err)
+	}
+	return user.Handle, nil
+}
+
+// send sends payload as JSON to url. If idempotent is set, the request is
+// retried on transient errors.
+func (s *REST) send(ctx context.Context, method, url string, payload any, idempotent bool) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	if idempotent {
+		// The nil value marks the request as idempotent for retries
+		// without sending the header.
+		req.Header["X-Idempotency-Key"] = nil
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if statusCode := res.StatusCode; statusCode < 200 || statusCode > 299 {
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			return fmt.Errorf("status code %d from Github. Additionally, reading the body errored with: %v", statusCode, err)
+		}
+		return fmt.Errorf("status code %d from Github: %s", statusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package github_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/shiftstack/ghira/pkg/github"
+)
+
+// redirectTransport sends the requests to the server instead of Github.
+type redirectTransport struct {
+	server *url.URL
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.server.Scheme, t.server.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestRESTLocate(t *testing.T) {
+	for _, tc := range [...]struct {
+		name     string
+		status   int
+		location string
+
+		wantMoved string
+		wantGone  bool
+		wantErr   bool
+	}{
+		{
+			name:   "still there",
+			status: http.StatusOK,
+		},
+		{
+			name:      "transferred",
+			status:    http.StatusMovedPermanently,
+			location:  "https://api.github.com/repositories/42/issues/7",
+			wantMoved: "https://github.com/o/other/issues/7",
+		},
+		{
+			name:      "transferred, relative location",
+			status:    http.StatusMovedPermanently,
+			location:  "/repositories/42/issues/7",
+			wantMoved: "https://github.com/o/other/issues/7",
+		},
+		{
+			name:    "transferred, no location",
+			status:  http.StatusMovedPermanently,
+			wantErr: true,
+		},
+		{
+			name:     "not found",
+			status:   http.StatusNotFound,
+			wantGone: true,
+		},
+		{
+			name:     "deleted",
+			status:   http.StatusGone,
+			wantGone: true,
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /repos/o/r/issues/1", func(w http.ResponseWriter, r *http.Request) {
+				if tc.location != "" {
+					w.Header().Set("Location", tc.location)
+				}
+				w.WriteHeader(tc.status)
+			})
+			mux.HandleFunc("GET /repositories/42/issues/7", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"number": 7, "title": "Crash", "html_url": "https://github.com/o/other/issues/7", "state": "open"}`))
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			serverURL, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rest := &github.REST{
+				Client:     &http.Client{Transport: &redirectTransport{server: serverURL}},
+				Repository: "o/r",
+			}
+			location, err := rest.Locate(context.Background(), 1)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+
+			var moved string
+			if location.Moved != nil {
+				moved = location.Moved.URL
+				if location.Moved.Number != 7 || location.Moved.Title != "Crash" {
+					t.Errorf("expected the transferred issue, got %+v", location.Moved)
+				}
+			}
+			if moved != tc.wantMoved {
+				t.Errorf("expected the issue to be moved to %q, got %q", tc.wantMoved, moved)
+			}
+			if location.Gone != tc.wantGone {
+				t.Errorf("expected gone %t, got %t", tc.wantGone, location.Gone)
+			}
+		})
+	}
+}
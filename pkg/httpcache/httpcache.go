@@ -0,0 +1,178 @@
+// Package httpcache implements an on-disk cache of HTTP responses that
+// revalidates its entries with conditional requests.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// entry is the on-disk representation of a cached response.
+type entry struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// Transport is an http.RoundTripper that stores successful GET responses
+// carrying an ETag or a Last-Modified header in Dir. Subsequent requests for
+// the same resource are sent with If-None-Match and If-Modified-Since; a 304
+// response is answered from the cache.
+//
+// Github does not count 304 responses against the primary rate limit.
+type Transport struct {
+	// Dir is the cache directory. It is created if missing.
+	Dir string
+
+	// Transport is the underlying RoundTripper. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+// key identifies a cached response. Headers that change the representation
+// or the visibility of the resource are part of the key.
+func key(req *http.Request) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s", req.Method, req.URL.String(), req.Header.Get("Accept"), req.Header.Get("Authorization"))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (t *Transport) path(req *http.Request) string {
+	return filepath.Join(t.Dir, key(req)+".json")
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.transport().RoundTrip(req)
+	}
+
+	cached, err := t.load(req)
+	if err != nil {
+		// A corrupt or unreadable entry is just a cache miss.
+		cached = nil
+	}
+
+	if cached != nil {
+		// RoundTrip must not modify the caller's request.
+		req = req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	res, err := t.transport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotModified && cached != nil:
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+
+		// Fresh headers (e.g. the rate-limit counters) take precedence
+		// over the stored ones.
+		for k, v := range res.Header {
+			cached.Header[k] = v
+		}
+		return cached.response(req), nil
+
+	case res.StatusCode == http.StatusOK && (res.Header.Get("ETag") != "" || res.Header.Get("Last-Modified") != ""):
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		res.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Failing to write the cache must not fail the request.
+		_ = t.store(req, entry{
+			URL:        req.URL.String(),
+			StatusCode: res.StatusCode,
+			Header:     res.Header,
+			Body:       body,
+		})
+	}
+
+	return res, nil
+}
+
+func (t *Transport) load(req *http.Request) (*entry, error) {
+	f, err := os.Open(t.path(req))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var e entry
+	if err := json.NewDecoder(f).Decode(&e); err != nil {
+		return nil, err
+	}
+	if e.URL != req.URL.String() {
+		return nil, nil
+	}
+	if e.Header == nil {
+		e.Header = make(http.Header)
+	}
+	return &e, nil
+}
+
+// store atomically writes the entry to the cache directory.
+func (t *Transport) store(req *http.Request, e entry) error {
+	if err := os.MkdirAll(t.Dir, 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(t.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := json.NewEncoder(f).Encode(e); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), t.path(req))
+}
+
+func (e *entry) response(req *http.Request) *http.Response {
+	header := e.Header.Clone()
+	header.Del("Content-Length")
+	header.Set("X-From-Cache", "1")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
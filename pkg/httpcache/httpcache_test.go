@@ -0,0 +1,138 @@
+package httpcache_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/shiftstack/ghira/pkg/httpcache"
+)
+
+// resource serves a body with an ETag, and answers 304 to the requests that
+// carry it.
+type resource struct {
+	mu          sync.Mutex
+	etag        string
+	body        string
+	remaining   string
+	ifNoneMatch []string
+}
+
+func (s *resource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ifNoneMatch = append(s.ifNoneMatch, r.Header.Get("If-None-Match"))
+	w.Header().Set("X-RateLimit-Remaining", s.remaining)
+	if r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	io.WriteString(w, s.body)
+}
+
+func (s *resource) set(etag, body, remaining string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.etag, s.body, s.remaining = etag, body, remaining
+}
+
+func get(t *testing.T, client *http.Client, url, token string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(body)
+}
+
+func TestTransport(t *testing.T) {
+	s := &resource{}
+	s.set(`"v1"`, "first", "10")
+	server := httptest.NewServer(s)
+	defer server.Close()
+	client := &http.Client{Transport: &httpcache.Transport{Dir: t.TempDir()}}
+
+	if res, body := get(t, client, server.URL, "a"); res.StatusCode != http.StatusOK || body != "first" {
+		t.Fatalf("expected the first response, got %d %q", res.StatusCode, body)
+	}
+
+	// Unchanged: the 304 is answered from the cache, with the fresh
+	// headers.
+	s.set(`"v1"`, "first", "9")
+	res, body := get(t, client, server.URL, "a")
+	if res.StatusCode != http.StatusOK || body != "first" || res.Header.Get("X-From-Cache") != "1" {
+		t.Errorf("expected the cached response, got %d %q %v", res.StatusCode, body, res.Header)
+	}
+	if got := res.Header.Get("X-RateLimit-Remaining"); got != "9" {
+		t.Errorf("expected the fresh rate-limit header, got %q", got)
+	}
+	if got := res.Header.Get("ETag"); got != `"v1"` {
+		t.Errorf("expected the cached ETag, got %q", got)
+	}
+
+	// Changed: the new response replaces the cached one.
+	s.set(`"v2"`, "second", "8")
+	if res, body := get(t, client, server.URL, "a"); res.StatusCode != http.StatusOK || body != "second" || res.Header.Get("X-From-Cache") != "" {
+		t.Errorf("expected the new response, got %d %q %v", res.StatusCode, body, res.Header)
+	}
+	if res, body := get(t, client, server.URL, "a"); body != "second" || res.Header.Get("X-From-Cache") != "1" {
+		t.Errorf("expected the new response to be cached, got %q %v", body, res.Header)
+	}
+
+	// Another token doesn't see the entries of the first one.
+	if _, body := get(t, client, server.URL, "b"); body != "second" {
+		t.Errorf("expected the response for the other token, got %q", body)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	want := []string{"", `"v1"`, `"v1"`, `"v2"`, ""}
+	if len(s.ifNoneMatch) != len(want) {
+		t.Fatalf("expected If-None-Match %q, got %q", want, s.ifNoneMatch)
+	}
+	for i := range want {
+		if s.ifNoneMatch[i] != want[i] {
+			t.Errorf("request %d: expected If-None-Match %q, got %q", i, want[i], s.ifNoneMatch[i])
+		}
+	}
+}
+
+func TestTransportNotCached(t *testing.T) {
+	s := &resource{}
+	s.set(`"v1"`, "first", "10")
+	server := httptest.NewServer(s)
+	defer server.Close()
+	client := &http.Client{Transport: &httpcache.Transport{Dir: t.TempDir()}}
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ifNoneMatch[1] != "" {
+		t.Errorf("expected the POST responses not to be cached, got If-None-Match %q", s.ifNoneMatch[1])
+	}
+}
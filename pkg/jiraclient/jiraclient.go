@@ -0,0 +1,46 @@
+package jiraclient
+
+import (
+	"net/http"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/shiftstack/ghira/pkg/metrics"
+	"github.com/shiftstack/ghira/pkg/retry"
+	"golang.org/x/time/rate"
+)
+
+// rateLimitedTransport holds every request until the shared limiter allows
+// it.
+type rateLimitedTransport struct {
+	limiter   *rate.Limiter
+	transport http.RoundTripper
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.transport.RoundTrip(req)
+}
+
+// NewWithToken returns a Jira client that waits out 429 responses and
+// retries 5xx responses and network errors with a bounded number of attempts.
+// Only requests that are safe to repeat are retried on 5xx and network
+// errors, so that a retried create can't produce a duplicate issue.
+//
+// If limiter is not nil, every request, including each retry, waits for it.
+// The limiter can be shared by concurrent users of the client. Each attempt
+// is bounded by timeout, unless it is zero.
+func NewWithToken(baseURL, jiraEmail, jiraToken string, limiter *rate.Limiter, timeout time.Duration) (*jira.Client, error) {
+	var transport http.RoundTripper = &metrics.Transport{Service: "Jira"}
+	if limiter != nil {
+		transport = &rateLimitedTransport{limiter: limiter, transport: transport}
+	}
+	authTransport := &jira.BasicAuthTransport{
+		Username:  jiraEmail,
+		Password:  jiraToken,
+		Transport: &retry.Transport{Name: "Jira", Transport: transport, Timeout: timeout},
+	}
+	return jira.NewClient(authTransport.Client(), baseURL)
+}
@@ -0,0 +1,95 @@
+package jiraclient_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/shiftstack/ghira/pkg/jiraclient"
+	"golang.org/x/time/rate"
+)
+
+// flaky fails the first request to each method with status, then succeeds.
+type flaky struct {
+	status int
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (s *flaky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.requests == nil {
+		s.requests = make(map[string]int)
+	}
+	s.requests[r.Method]++
+	first := s.requests[r.Method] == 1
+	s.mu.Unlock()
+
+	if first {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(s.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"key": "OSASINFRA-1"}`))
+}
+
+func TestNewWithToken(t *testing.T) {
+	for _, tc := range [...]struct {
+		name       string
+		status     int
+		wantGets   int
+		wantPosts  int
+		wantCreate bool
+	}{
+		{
+			name:       "rate limited",
+			status:     http.StatusTooManyRequests,
+			wantGets:   2,
+			wantPosts:  2,
+			wantCreate: true,
+		},
+		{
+			// A create that failed with a 5xx may have been
+			// processed: it is not sent again.
+			name:      "server error",
+			status:    http.StatusBadGateway,
+			wantGets:  2,
+			wantPosts: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &flaky{status: tc.status}
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			client, err := jiraclient.NewWithToken(server.URL, "ghira@example.com", "token", rate.NewLimiter(rate.Inf, 1), time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+
+			if _, _, err := client.Issue.GetWithContext(ctx, "OSASINFRA-1", nil); err != nil {
+				t.Errorf("expected the GET to be retried, got %v", err)
+			}
+			_, _, err = client.Issue.CreateWithContext(ctx, &jira.Issue{Fields: &jira.IssueFields{Summary: "Crash"}})
+			if created := err == nil; created != tc.wantCreate {
+				t.Errorf("expected the create to succeed %t, got %v", tc.wantCreate, err)
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if got := s.requests[http.MethodGet]; got != tc.wantGets {
+				t.Errorf("expected %d GET requests, got %d", tc.wantGets, got)
+			}
+			if got := s.requests[http.MethodPost]; got != tc.wantPosts {
+				t.Errorf("expected %d POST requests, got %d", tc.wantPosts, got)
+			}
+		})
+	}
+}
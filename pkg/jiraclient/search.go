@@ -0,0 +1,73 @@
+package jiraclient
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+const searchPageSize = 100
+
+// SearchIssues streams the issues matching jql. Only the given fields are
+// requested.
+//
+// Jira Cloud paginates searches with a continuation token, so pages can't be
+// requested in parallel; instead, the next page is fetched while the current
+// one is being consumed.
+//
+// The error channel receives at most one error and is closed before the
+// issue channel, so that it can be read once the issue channel is drained.
+func SearchIssues(ctx context.Context, client *jira.Client, jql string, fields []string) (<-chan jira.Issue, <-chan error) {
+	issueCh := make(chan jira.Issue)
+	errCh := make(chan error, 1)
+	pageCh := make(chan []jira.Issue, 1)
+
+	go func() {
+		defer close(pageCh)
+		defer close(errCh)
+
+		opt := &jira.SearchOptionsV2{MaxResults: searchPageSize, Fields: fields}
+		for {
+			issues, res, err := client.Issue.SearchV2JQLWithContext(ctx, jql, opt)
+			if err != nil {
+				errCh <- fmt.Errorf("error fetching issues: %w", err)
+				return
+			}
+
+			slog.Debug("Incoming batch of Jira issues", "count", len(issues))
+
+			select {
+			case pageCh <- issues:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+
+			if res.IsLast || res.NextPageToken == "" {
+				return
+			}
+			opt.NextPageToken = res.NextPageToken
+		}
+	}()
+
+	go func() {
+		defer close(issueCh)
+
+		for page := range pageCh {
+			for _, issue := range page {
+				select {
+				case issueCh <- issue:
+				case <-ctx.Done():
+					// Drain the pages so that the fetcher can exit.
+					for range pageCh {
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	return issueCh, errCh
+}
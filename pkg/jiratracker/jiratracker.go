@@ -0,0 +1,407 @@
+// Package jiratracker mirrors Github issues into Jira.
+package jiratracker
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/shiftstack/ghira/pkg/github"
+	"github.com/shiftstack/ghira/pkg/jiraclient"
+	"github.com/shiftstack/ghira/pkg/reconcile"
+)
+
+// knownIssueFields are the Jira fields needed to build a KnownIssue.
+var knownIssueFields = []string{"summary", "status", "resolution", "project", "issuetype", "description", "assignee", "labels", "fixVersions"}
+
+// syncedFieldsProperty is the issue property holding the field values
+// recorded at the last sync.
+//
+// https://developer.atlassian.com/cloud/jira/platform/jira-entity-properties/
+const syncedFieldsProperty = "ghira.sync"
+
+// descriptionHeaderRegex matches the link to the Github issue that precedes
+// its body in the Jira description.
+var descriptionHeaderRegex = regexp.MustCompile(`^Originally posted on Github: \S*\n\n`)
+
+// Tracker implements reconcile.Tracker. The Jira issues are recognised by
+// the Github issue number in their summary, which starts with
+// "<SummaryPrefix><number>: ", or by the links made with Link. Issues resolved
+// as duplicates are ignored; when several issues mirror the same Github issue,
+// the linked one is used, or else the oldest one.
+type Tracker struct {
+	Client *jira.Client
+
+	// JQL selects the issues that may mirror a Github issue.
+	JQL string
+
+	// Project and Component are where new issues are created.
+	Project   string
+	Component string
+
+	// SummaryPrefix precedes the Github issue number in the summary.
+	SummaryPrefix string
+
+	summaryRegexOnce   sync.Once
+	ghIssueNumberRegex *regexp.Regexp
+
+	// linked caches the links read last, for IssueNumber.
+	linkedMu sync.Mutex
+	linked   map[int]string
+}
+
+var _ reconcile.Tracker = (*Tracker)(nil)
+
+func (t *Tracker) summaryRegex() *regexp.Regexp {
+	t.summaryRegexOnce.Do(func() {
+		t.ghIssueNumberRegex = regexp.MustCompile(regexp.QuoteMeta(t.SummaryPrefix) + `(\d+): `)
+	})
+	return t.ghIssueNumberRegex
+}
+
+// GithubNumber returns the number of the Github issue mirrored by the Jira
+// issue with the given summary, if any. Summaries can be edited by hand: a
+// number that doesn't parse is ignored.
+func (t *Tracker) GithubNumber(summary string) (int, bool) {
+	s := t.summaryRegex().FindStringSubmatch(summary)
+	if len(s) < 2 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s[1])
+	if err != nil {
+		slog.Warn("Ignoring a Jira summary with an invalid Github issue number", "summary", summary, "error", err)
+		return 0, false
+	}
+	return n, true
+}
+
+// mirrored returns the number of the Github issue mirrored by a Jira issue,
+// if any.
+func (t *Tracker) mirrored(issue jira.Issue) (int, bool) {
+	if r := issue.Fields.Resolution; r != nil && r.Name == duplicateResolution {
+		return 0, false
+	}
+	return t.GithubNumber(issue.Fields.Summary)
+}
+
+func (t *Tracker) KnownIssues(ctx context.Context) (map[int]reconcile.KnownIssue, error) {
+	byNumber := make(map[int][]reconcile.KnownIssue)
+	knownIssues, searchErr := jiraclient.SearchIssues(ctx, t.Client, t.JQL, knownIssueFields)
+	for issue := range knownIssues {
+		if n, ok := t.mirrored(issue); ok {
+			byNumber[n] = append(byNumber[n], t.toKnownIssue(issue))
+		}
+	}
+	if err := <-searchErr; err != nil {
+		return nil, err
+	}
+
+	linked, err := t.Links(ctx)
+	if err != nil {
+		return nil, err
+	}
+	linkedIssues, err := t.linkedIssues(ctx, linked)
+	if err != nil {
+		return nil, err
+	}
+	for n, issue := range linkedIssues {
+		byNumber[n] = append(byNumber[n], issue)
+	}
+
+	alreadyKnown := make(map[int]reconcile.KnownIssue, len(byNumber))
+	for n, issues := range byNumber {
+		alreadyKnown[n] = canonical(issues, linked[n])
+	}
+	return alreadyKnown, nil
+}
+
+// canonical returns the issue to sync among the issues mirroring the same
+// Github issue, with the keys of the others as its duplicates: the issue
+// linked by hand if any, or else the oldest one.
+func canonical(issues []reconcile.KnownIssue, linked string) reconcile.KnownIssue {
+	slices.SortFunc(issues, func(a, b reconcile.KnownIssue) int {
+		return cmp.Or(-cmp.Compare(boolInt(a.Key == linked), boolInt(b.Key == linked)), compareKeys(a.Key, b.Key))
+	})
+	// A linked issue can also be found by its summary.
+	issues = slices.CompactFunc(issues, func(a, b reconcile.KnownIssue) bool { return a.Key == b.Key })
+
+	known := issues[0]
+	for _, issue := range issues[1:] {
+		known.Duplicates = append(known.Duplicates, issue.Key)
+	}
+	return known
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// compareKeys orders issue keys by project, then by creation.
+func compareKeys(a, b string) int {
+	aProject, aNumber := splitKey(a)
+	bProject, bNumber := splitKey(b)
+	return cmp.Or(strings.Compare(aProject, bProject), cmp.Compare(aNumber, bNumber))
+}
+
+func splitKey(key string) (string, int) {
+	i := strings.LastIndexByte(key, '-')
+	if i < 0 {
+		return key, 0
+	}
+	n, _ := strconv.Atoi(key[i+1:])
+	return key[:i], n
+}
+
+func (t *Tracker) KnownIssue(ctx context.Context, number int) (reconcile.KnownIssue, bool, error) {
+	// The text search is fuzzy: the results are filtered on the exact
+	// summary prefix.
+	jql := fmt.Sprintf(`(%s) AND summary ~ "\"%s%d\""`, t.JQL, t.SummaryPrefix, number)
+	var known []reconcile.KnownIssue
+	issues, searchErr := jiraclient.SearchIssues(ctx, t.Client, jql, knownIssueFields)
+	for issue := range issues {
+		if n, ok := t.mirrored(issue); ok && n == number {
+			known = append(known, t.toKnownIssue(issue))
+		}
+	}
+	if err := <-searchErr; err != nil {
+		return reconcile.KnownIssue{}, false, err
+	}
+
+	linked, err := t.Links(ctx)
+	if err != nil {
+		return reconcile.KnownIssue{}, false, err
+	}
+	if key, ok := linked[number]; ok {
+		linkedIssues, err := t.linkedIssues(ctx, map[int]string{number: key})
+		if err != nil {
+			return reconcile.KnownIssue{}, false, err
+		}
+		if issue, ok := linkedIssues[number]; ok {
+			known = append(known, issue)
+		}
+	}
+
+	if len(known) == 0 {
+		return reconcile.KnownIssue{}, false, nil
+	}
+	return canonical(known, linked[number]), true, nil
+}
+
+// IssueByKey fetches the issue with the given key, and returns the number of
+// the Github issue it mirrors, or 0 if it is neither linked to one nor
+// references one in its summary, or if it is resolved as a duplicate.
+func (t *Tracker) IssueByKey(ctx context.Context, key string) (reconcile.KnownIssue, int, error) {
+	issue, response, err := t.Client.Issue.GetWithContext(ctx, key, &jira.GetQueryOptions{Fields: strings.Join(knownIssueFields, ",")})
+	if err != nil {
+		return reconcile.KnownIssue{}, 0, jira.NewJiraError(response, err)
+	}
+	n, ok := t.mirrored(*issue)
+	if !ok && (issue.Fields.Resolution == nil || issue.Fields.Resolution.Name != duplicateResolution) {
+		linked, err := t.Links(ctx)
+		if err != nil {
+			return reconcile.KnownIssue{}, 0, err
+		}
+		for number, linkedKey := range linked {
+			if linkedKey == key {
+				n = number
+			}
+		}
+	}
+	return t.toKnownIssue(*issue), n, nil
+}
+
+func (t *Tracker) toKnownIssue(issue jira.Issue) reconcile.KnownIssue {
+	labels := slices.Sorted(slices.Values(issue.Fields.Labels))
+	known := reconcile.KnownIssue{
+		Key:       issue.Key,
+		Project:   issue.Fields.Project.Key,
+		IssueType: issue.Fields.Type.ID,
+		Fields: reconcile.FieldValues{
+			"summary":     t.title(issue.Fields.Summary),
+			"description": descriptionHeaderRegex.ReplaceAllString(issue.Fields.Description, ""),
+			"labels":      strings.Join(labels, ","),
+		},
+	}
+	if status := issue.Fields.Status; status != nil {
+		known.Status = reconcile.Status{ID: status.ID, Name: status.Name}
+	}
+	if assignee := issue.Fields.Assignee; assignee != nil {
+		known.Fields["assignee"] = assignee.AccountID
+	}
+	var versions []string
+	for _, v := range issue.Fields.FixVersions {
+		versions = append(versions, v.Name)
+	}
+	known.Fields["fixVersion"] = strings.Join(versions, ",")
+	return known
+}
+
+// title returns the summary without the prefix and the Github issue number.
+// The text around them is kept.
+func (t *Tracker) title(summary string) string {
+	if loc := t.summaryRegex().FindStringIndex(summary); loc != nil {
+		return summary[:loc[0]] + summary[loc[1]:]
+	}
+	return summary
+}
+
+func (t *Tracker) summary(issue github.Issue) string {
+	return t.SummaryPrefix + strconv.Itoa(issue.Number) + ": " + issue.Title
+}
+
+func description(issue github.Issue) string {
+	return fmt.Sprintf("Originally posted on Github: %s\n\n%s", issue.URL, issue.Body)
+}
+
+func (t *Tracker) Create(ctx context.Context, issue github.Issue) (string, error) {
+	i := jira.Issue{
+		Fields: &jira.IssueFields{
+			Description: description(issue),
+			Type: jira.IssueType{
+				Name: "Task",
+			},
+			Project: jira.Project{
+				Key: t.Project,
+			},
+			Summary:    t.summary(issue),
+			Components: []*jira.Component{{Name: t.Component}},
+		},
+	}
+
+	if assignee := issue.Assignee.JiraAccountID; assignee != "" {
+		i.Fields.Assignee = &jira.User{
+			AccountID: assignee,
+		}
+	}
+
+	if author := issue.Author.JiraAccountID; author != "" {
+		i.Fields.Reporter = &jira.User{
+			AccountID: author,
+		}
+	}
+
+	jiraIssue, response, err := t.Client.Issue.CreateWithContext(ctx, &i)
+	if err != nil {
+		// The response is nil on network errors. Otherwise its body
+		// holds the reason of the failure.
+		return "", jira.NewJiraError(response, err)
+	}
+
+	return jiraIssue.Key, nil
+}
+
+func (t *Tracker) Transitions(ctx context.Context, issue reconcile.KnownIssue) ([]reconcile.Transition, error) {
+	jiraTransitions, _, err := t.Client.Issue.GetTransitionsWithContext(ctx, issue.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	transitions := make([]reconcile.Transition, 0, len(jiraTransitions))
+	for _, v := range jiraTransitions {
+		transitions = append(transitions, reconcile.Transition{ID: v.ID, Name: v.Name})
+	}
+	return transitions, nil
+}
+
+func (t *Tracker) DoTransition(ctx context.Context, key, transitionID string) error {
+	_, err := t.Client.Issue.DoTransitionWithContext(ctx, key, transitionID)
+	return err
+}
+
+func (t *Tracker) UpdateFields(ctx context.Context, key string, issue github.Issue, fields []string) error {
+	update := make(map[string]any)
+	for _, field := range fields {
+		switch field {
+		case "summary":
+			update["summary"] = t.summary(issue)
+		case "description":
+			update["description"] = description(issue)
+		case "assignee":
+			if issue.Assignee.JiraAccountID == "" {
+				update["assignee"] = nil
+			} else {
+				update["assignee"] = map[string]string{"accountId": issue.Assignee.JiraAccountID}
+			}
+		case "labels":
+			labels := []string{}
+			for _, l := range issue.Labels {
+				labels = append(labels, strings.ReplaceAll(l.Name, " ", "_"))
+			}
+			update["labels"] = labels
+		case "fixVersion":
+			versions := []map[string]string{}
+			if issue.Milestone != nil {
+				versions = append(versions, map[string]string{"name": issue.Milestone.Title})
+			}
+			update["fixVersions"] = versions
+		default:
+			return fmt.Errorf("field %q can't be updated", field)
+		}
+	}
+	response, err := t.Client.Issue.UpdateIssueWithContext(ctx, key, map[string]any{"fields": update})
+	if err != nil {
+		return jira.NewJiraError(response, err)
+	}
+	return nil
+}
+
+// syncedFields is the value of the syncedFieldsProperty issue property.
+type syncedFields struct {
+	Fields reconcile.FieldValues `json:"fields"`
+}
+
+func (t *Tracker) SyncedFields(ctx context.Context, key string) (reconcile.FieldValues, error) {
+	var value syncedFields
+	if _, err := t.getProperty(ctx, key, syncedFieldsProperty, &value); err != nil {
+		return nil, err
+	}
+	return value.Fields, nil
+}
+
+func (t *Tracker) SetSyncedFields(ctx context.Context, key string, values reconcile.FieldValues) error {
+	return t.setProperty(ctx, key, syncedFieldsProperty, syncedFields{Fields: values})
+}
+
+// getProperty decodes the value of a property of the issue with the given
+// key into v, and reports whether the property exists.
+func (t *Tracker) getProperty(ctx context.Context, key, property string, v any) (bool, error) {
+	req, err := t.Client.NewRequestWithContext(ctx, http.MethodGet, "rest/api/2/issue/"+key+"/properties/"+property, nil)
+	if err != nil {
+		return false, err
+	}
+	value := struct {
+		Value any `json:"value"`
+	}{Value: v}
+	response, err := t.Client.Do(req, &value)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, jira.NewJiraError(response, err)
+	}
+	return true, nil
+}
+
+// setProperty sets a property of the issue with the given key.
+func (t *Tracker) setProperty(ctx context.Context, key, property string, v any) error {
+	req, err := t.Client.NewRequestWithContext(ctx, http.MethodPut, "rest/api/2/issue/"+key+"/properties/"+property, v)
+	if err != nil {
+		return err
+	}
+	response, err := t.Client.Do(req, nil)
+	if err != nil {
+		return jira.NewJiraError(response, err)
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package jiratracker_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/shiftstack/ghira/pkg/jiratracker"
+)
+
+// fakeIssue is an issue of fakeJira.
+type fakeIssue struct {
+	Summary    string
+	Status     string
+	Resolution string
+	Comments   []string
+}
+
+// fakeLink is a link of fakeJira, as created: the inward issue "is
+// duplicated by" the outward issue, for example. The outward issue shows it
+// with the inward issue as its "outwardIssue", and conversely.
+type fakeLink struct {
+	Type    string
+	Inward  string
+	Outward string
+}
+
+// fakeJira serves the parts of the Jira REST API used by the tracker, from
+// memory, and counts the requests that change something.
+type fakeJira struct {
+	mu         sync.Mutex
+	issues     map[string]*fakeIssue
+	links      map[string]fakeLink
+	nextLink   int
+	properties map[string]json.RawMessage
+	changes    map[string]int
+}
+
+func newFakeJira(t *testing.T, issues map[string]*fakeIssue) (*fakeJira, *jira.Client) {
+	t.Helper()
+	f := &fakeJira{
+		issues:     issues,
+		links:      make(map[string]fakeLink),
+		properties: make(map[string]json.RawMessage),
+		changes:    make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rest/api/2/issue/{key}", f.getIssue)
+	mux.HandleFunc("PUT /rest/api/2/issue/{key}", f.updateIssue)
+	mux.HandleFunc("POST /rest/api/2/issue/{key}/comment", f.addComment)
+	mux.HandleFunc("GET /rest/api/2/issue/{key}/transitions", f.getTransitions)
+	mux.HandleFunc("POST /rest/api/2/issue/{key}/transitions", f.doTransition)
+	mux.HandleFunc("POST /rest/api/2/issueLink", f.addLink)
+	mux.HandleFunc("DELETE /rest/api/2/issueLink/{id}", f.deleteLink)
+	mux.HandleFunc("GET /rest/api/2/project/{project}/properties/{property}", f.getProperty)
+	mux.HandleFunc("PUT /rest/api/2/project/{project}/properties/{property}", f.setProperty)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := jira.NewClient(nil, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, client
+}
+
+// AddLink adds a link, as created with the given inward and outward issues.
+func (f *fakeJira) AddLink(l fakeLink) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextLink++
+	f.links[strconv.Itoa(f.nextLink)] = l
+}
+
+// Links returns the links.
+func (f *fakeJira) Links() map[fakeLink]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	links := make(map[fakeLink]int)
+	for _, l := range f.links {
+		links[l]++
+	}
+	return links
+}
+
+// Changes returns the number of requests that changed something, by
+// "METHOD pattern".
+func (f *fakeJira) Changes() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	changes := make(map[string]int, len(f.changes))
+	for k, v := range f.changes {
+		changes[k] = v
+	}
+	return changes
+}
+
+func (f *fakeJira) issue(w http.ResponseWriter, r *http.Request) (*fakeIssue, bool) {
+	issue, ok := f.issues[r.PathValue("key")]
+	if !ok {
+		http.Error(w, `{"errorMessages": ["Issue does not exist"]}`, http.StatusNotFound)
+	}
+	return issue, ok
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeJira) getIssue(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	issue, ok := f.issue(w, r)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+
+	fields := map[string]any{"summary": issue.Summary}
+	if issue.Status != "" {
+		fields["status"] = map[string]string{"name": issue.Status}
+	}
+	if issue.Resolution != "" {
+		fields["resolution"] = map[string]string{"name": issue.Resolution}
+	}
+	comments := []map[string]any{}
+	for i, body := range issue.Comments {
+		comments = append(comments, map[string]any{
+			"id":      strconv.Itoa(i + 1),
+			"body":    body,
+			"author":  map[string]string{"displayName": "Alice"},
+			"created": "2024-01-02T03:04:05.000+0000",
+		})
+	}
+	fields["comment"] = map[string]any{"comments": comments}
+	links := []map[string]any{}
+	for id, l := range f.links {
+		link := map[string]any{"id": id, "type": map[string]string{"name": l.Type}}
+		switch key {
+		case l.Outward:
+			link["outwardIssue"] = map[string]string{"key": l.Inward}
+		case l.Inward:
+			link["inwardIssue"] = map[string]string{"key": l.Outward}
+		default:
+			continue
+		}
+		links = append(links, link)
+	}
+	fields["issuelinks"] = links
+
+	writeJSON(w, http.StatusOK, map[string]any{"key": key, "fields": fields})
+}
+
+func (f *fakeJira) updateIssue(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	issue, ok := f.issue(w, r)
+	if !ok {
+		return
+	}
+	var update struct {
+		Fields struct {
+			Summary    *string `json:"summary"`
+			Resolution *struct {
+				Name string `json:"name"`
+			} `json:"resolution"`
+		} `json:"fields"`
+	}
+	if !decodeBody(w, r, &update) {
+		return
+	}
+	if s := update.Fields.Summary; s != nil {
+		issue.Summary = *s
+	}
+	if res := update.Fields.Resolution; res != nil {
+		issue.Resolution = res.Name
+	}
+	f.changes[r.Pattern]++
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeJira) addComment(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	issue, ok := f.issue(w, r)
+	if !ok {
+		return
+	}
+	var comment struct {
+		Body string `json:"body"`
+	}
+	if !decodeBody(w, r, &comment) {
+		return
+	}
+	issue.Comments = append(issue.Comments, comment.Body)
+	f.changes[r.Pattern]++
+	writeJSON(w, http.StatusCreated, map[string]any{"id": strconv.Itoa(len(issue.Comments)), "body": comment.Body})
+}
+
+func (f *fakeJira) getTransitions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"transitions": []map[string]string{
+		{"id": "1", "name": "To Do"},
+		{"id": "2", "name": "Closed"},
+	}})
+}
+
+func (f *fakeJira) doTransition(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	issue, ok := f.issue(w, r)
+	if !ok {
+		return
+	}
+	var payload struct {
+		Transition struct {
+			ID string `json:"id"`
+		} `json:"transition"`
+		Fields struct {
+			Resolution struct {
+				Name string `json:"name"`
+			} `json:"resolution"`
+		} `json:"fields"`
+	}
+	if !decodeBody(w, r, &payload) {
+		return
+	}
+	if payload.Transition.ID != "2" {
+		http.Error(w, "unexpected transition "+payload.Transition.ID, http.StatusBadRequest)
+		return
+	}
+	issue.Status, issue.Resolution = "Closed", payload.Fields.Resolution.Name
+	f.changes[r.Pattern]++
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeJira) addLink(w http.ResponseWriter, r *http.Request) {
+	var link struct {
+		Type struct {
+			Name string `json:"name"`
+		} `json:"type"`
+		InwardIssue struct {
+			Key string `json:"key"`
+		} `json:"inwardIssue"`
+		OutwardIssue struct {
+			Key string `json:"key"`
+		} `json:"outwardIssue"`
+	}
+	if !decodeBody(w, r, &link) {
+		return
+	}
+	f.AddLink(fakeLink{Type: link.Type.Name, Inward: link.InwardIssue.Key, Outward: link.OutwardIssue.Key})
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.changes[r.Pattern]++
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (f *fakeJira) deleteLink(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.links[r.PathValue("id")]; !ok {
+		http.Error(w, "no such link", http.StatusNotFound)
+		return
+	}
+	delete(f.links, r.PathValue("id"))
+	f.changes[r.Pattern]++
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeJira) getProperty(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.properties[r.PathValue("project")+"/"+r.PathValue("property")]
+	if !ok {
+		http.Error(w, `{"errorMessages": ["The property was not found"]}`, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"key": r.PathValue("property"), "value": value})
+}
+
+func (f *fakeJira) setProperty(w http.ResponseWriter, r *http.Request) {
+	var value json.RawMessage
+	if !decodeBody(w, r, &value) {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.properties[r.PathValue("project")+"/"+r.PathValue("property")] = value
+	f.changes[r.Pattern]++
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestGithubNumber(t *testing.T) {
+	tracker := &jiratracker.Tracker{SummaryPrefix: "GH-orc-"}
+	for _, tc := range [...]struct {
+		summary string
+		want    int
+		wantOK  bool
+	}{
+		{summary: "GH-orc-12: Crash", want: 12, wantOK: true},
+		{summary: "Crash"},
+		{summary: "GH-orc-12 Crash"},
+		{summary: "GH-orc-99999999999999999999: Crash"},
+	} {
+		t.Run(tc.summary, func(t *testing.T) {
+			n, ok := tracker.GithubNumber(tc.summary)
+			if n != tc.want || ok != tc.wantOK {
+				t.Errorf("expected %d, %t, got %d, %t", tc.want, tc.wantOK, n, ok)
+			}
+		})
+	}
+}
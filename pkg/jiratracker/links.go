@@ -0,0 +1,240 @@
+package jiratracker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/shiftstack/ghira/pkg/reconcile"
+)
+
+// linksProperty is the project property holding the Jira issues linked to
+// a Github issue by hand. Writing it requires the "Administer Projects"
+// permission, and the callers hold the reconciler lock, as Jira can't update
+// a property conditionally.
+const linksProperty = "ghira.links"
+
+// links is the value of the linksProperty project property: the keys of the
+// linked issues, by summary prefix, then by Github number.
+type links map[string]map[string]string
+
+func (t *Tracker) linksURL() string {
+	return "rest/api/2/project/" + t.Project + "/properties/" + linksProperty
+}
+
+func (t *Tracker) readLinks(ctx context.Context) (links, error) {
+	req, err := t.Client.NewRequestWithContext(ctx, http.MethodGet, t.linksURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var property struct {
+		Value links `json:"value"`
+	}
+	response, err := t.Client.Do(req, &property)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return links{}, nil
+		}
+		return nil, jira.NewJiraError(response, err)
+	}
+	if property.Value == nil {
+		return links{}, nil
+	}
+	return property.Value, nil
+}
+
+func (t *Tracker) writeLinks(ctx context.Context, value links) error {
+	req, err := t.Client.NewRequestWithContext(ctx, http.MethodPut, t.linksURL(), value)
+	if err != nil {
+		return err
+	}
+	response, err := t.Client.Do(req, nil)
+	if err != nil {
+		return jira.NewJiraError(response, err)
+	}
+	return nil
+}
+
+// Links returns the keys of the Jira issues linked by hand, by Github number.
+func (t *Tracker) Links(ctx context.Context) (map[int]string, error) {
+	value, err := t.readLinks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the links: %w", err)
+	}
+	linked := make(map[int]string, len(value[t.SummaryPrefix]))
+	for number, key := range value[t.SummaryPrefix] {
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Github number %q in the links", number)
+		}
+		linked[n] = key
+	}
+
+	t.linkedMu.Lock()
+	t.linked = linked
+	t.linkedMu.Unlock()
+	return linked, nil
+}
+
+// IssueNumber returns the number of the Github issue mirrored by the Jira
+// issue with the given key and summary: the number in its summary, or else
+// the number it is linked to. The links are those read last, by a run or a
+// single-issue sync.
+func (t *Tracker) IssueNumber(key, summary string) (int, bool) {
+	if n, ok := t.GithubNumber(summary); ok {
+		return n, true
+	}
+
+	t.linkedMu.Lock()
+	defer t.linkedMu.Unlock()
+	for n, linked := range t.linked {
+		if linked == key {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// linkedIssues fetches the issues linked by hand, by Github number. The
+// linked issues that were deleted or resolved as duplicates are ignored.
+func (t *Tracker) linkedIssues(ctx context.Context, linked map[int]string) (map[int]reconcile.KnownIssue, error) {
+	issues := make(map[int]reconcile.KnownIssue, len(linked))
+	for n, key := range linked {
+		issue, response, err := t.Client.Issue.GetWithContext(ctx, key, &jira.GetQueryOptions{Fields: strings.Join(knownIssueFields, ",")})
+		if err != nil {
+			if response != nil && response.StatusCode == http.StatusNotFound {
+				slog.Warn("The Jira issue linked to the Github issue doesn't exist", "gh_number", n, "jira_key", key)
+				continue
+			}
+			return nil, fmt.Errorf("error fetching the linked issue %s: %w", key, jira.NewJiraError(response, err))
+		}
+		if r := issue.Fields.Resolution; r != nil && r.Name == duplicateResolution {
+			continue
+		}
+		issues[n] = t.toKnownIssue(*issue)
+	}
+	return issues, nil
+}
+
+// Link associates the issue with the given key with a Github issue. If
+// rewriteSummary is set, the summary is also given the prefix of the mirrors.
+// A Github issue already linked to another issue, and an issue whose summary
+// mirrors another Github issue, are only taken over with force.
+func (t *Tracker) Link(ctx context.Context, number int, key string, rewriteSummary, force bool) error {
+	value, err := t.readLinks(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading the links: %w", err)
+	}
+	for n, linked := range value[t.SummaryPrefix] {
+		if linked == key && n != strconv.Itoa(number) {
+			return fmt.Errorf("%s is already linked to #%s", key, n)
+		}
+	}
+	if linked, ok := value[t.SummaryPrefix][strconv.Itoa(number)]; ok && linked != key && !force {
+		return fmt.Errorf("#%d is already linked to %s", number, linked)
+	}
+
+	summary, err := t.fetchSummary(ctx, key)
+	if err != nil {
+		return err
+	}
+	if mirrored, ok := t.GithubNumber(summary); ok && mirrored != number && !force {
+		return fmt.Errorf("%s mirrors #%d according to its summary", key, mirrored)
+	}
+	if rewriteSummary {
+		if err := t.updateSummary(ctx, key, t.SummaryPrefix+strconv.Itoa(number)+": "+t.title(summary)); err != nil {
+			return err
+		}
+	}
+
+	if value[t.SummaryPrefix] == nil {
+		value[t.SummaryPrefix] = make(map[string]string)
+	}
+	value[t.SummaryPrefix][strconv.Itoa(number)] = key
+	if err := t.writeLinks(ctx, value); err != nil {
+		return fmt.Errorf("error writing the links: %w", err)
+	}
+	return nil
+}
+
+// Unlink dissociates the issue with the given key from a Github issue. If
+// rewriteSummary is set, the prefix of the Github issue is also removed from
+// the summary; otherwise, an issue that has it still mirrors the Github
+// issue. The prefix of another Github issue is an error.
+func (t *Tracker) Unlink(ctx context.Context, number int, key string, rewriteSummary bool) error {
+	value, err := t.readLinks(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading the links: %w", err)
+	}
+	linked := value[t.SummaryPrefix][strconv.Itoa(number)] == key
+
+	if rewriteSummary {
+		summary, err := t.fetchSummary(ctx, key)
+		if err != nil {
+			return err
+		}
+		mirrored, ok := t.GithubNumber(summary)
+		switch {
+		case ok && mirrored != number:
+			return fmt.Errorf("%s mirrors #%d according to its summary, not #%d", key, mirrored, number)
+		case ok:
+			if err := t.updateSummary(ctx, key, t.title(summary)); err != nil {
+				return err
+			}
+		case !linked:
+			return fmt.Errorf("%s is neither linked to #%d nor mirrors it", key, number)
+		}
+	} else if !linked {
+		return fmt.Errorf("%s is not linked to #%d", key, number)
+	}
+
+	if linked {
+		delete(value[t.SummaryPrefix], strconv.Itoa(number))
+		if err := t.writeLinks(ctx, value); err != nil {
+			return fmt.Errorf("error writing the links: %w", err)
+		}
+	}
+	return nil
+}
+
+// dropLinks removes the links to the issue with the given key, if any.
+func (t *Tracker) dropLinks(ctx context.Context, key string) error {
+	value, err := t.readLinks(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading the links: %w", err)
+	}
+	var dropped bool
+	for n, linked := range value[t.SummaryPrefix] {
+		if linked == key {
+			delete(value[t.SummaryPrefix], n)
+			dropped = true
+		}
+	}
+	if !dropped {
+		return nil
+	}
+	if err := t.writeLinks(ctx, value); err != nil {
+		return fmt.Errorf("error writing the links: %w", err)
+	}
+	return nil
+}
+
+func (t *Tracker) fetchSummary(ctx context.Context, key string) (string, error) {
+	issue, response, err := t.Client.Issue.GetWithContext(ctx, key, &jira.GetQueryOptions{Fields: "summary"})
+	if err != nil {
+		return "", fmt.Errorf("error fetching %s: %w", key, jira.NewJiraError(response, err))
+	}
+	return issue.Fields.Summary, nil
+}
+
+func (t *Tracker) updateSummary(ctx context.Context, key, summary string) error {
+	update := map[string]any{"fields": map[string]any{"summary": summary}}
+	if response, err := t.Client.Issue.UpdateIssueWithContext(ctx, key, update); err != nil {
+		return fmt.Errorf("error updating the summary of %s: %w", key, jira.NewJiraError(response, err))
+	}
+	return nil
+}
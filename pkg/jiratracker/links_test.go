@@ -0,0 +1,236 @@
+package jiratracker_test
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"strconv"
+	"testing"
+
+	"github.com/shiftstack/ghira/pkg/github"
+	"github.com/shiftstack/ghira/pkg/jiratracker"
+)
+
+func TestLink(t *testing.T) {
+	for _, tc := range [...]struct {
+		name    string
+		links   map[int]string
+		summary string
+		number  int
+		key     string
+		rewrite bool
+		force   bool
+
+		wantErr     bool
+		wantLinks   map[int]string
+		wantSummary string
+	}{
+		{
+			name:        "new link",
+			summary:     "Crash",
+			number:      1,
+			key:         "OSASINFRA-5",
+			wantLinks:   map[int]string{1: "OSASINFRA-5"},
+			wantSummary: "Crash",
+		},
+		{
+			name:        "already linked",
+			links:       map[int]string{1: "OSASINFRA-5"},
+			summary:     "Crash",
+			number:      1,
+			key:         "OSASINFRA-5",
+			wantLinks:   map[int]string{1: "OSASINFRA-5"},
+			wantSummary: "Crash",
+		},
+		{
+			name:        "number linked to another issue",
+			links:       map[int]string{1: "OSASINFRA-4"},
+			summary:     "Crash",
+			number:      1,
+			key:         "OSASINFRA-5",
+			wantErr:     true,
+			wantLinks:   map[int]string{1: "OSASINFRA-4"},
+			wantSummary: "Crash",
+		},
+		{
+			name:        "number linked to another issue, with force",
+			links:       map[int]string{1: "OSASINFRA-4"},
+			summary:     "Crash",
+			number:      1,
+			key:         "OSASINFRA-5",
+			force:       true,
+			wantLinks:   map[int]string{1: "OSASINFRA-5"},
+			wantSummary: "Crash",
+		},
+		{
+			name:        "issue linked to another number",
+			links:       map[int]string{2: "OSASINFRA-5"},
+			summary:     "Crash",
+			number:      1,
+			key:         "OSASINFRA-5",
+			force:       true,
+			wantErr:     true,
+			wantLinks:   map[int]string{2: "OSASINFRA-5"},
+			wantSummary: "Crash",
+		},
+		{
+			name:        "summary mirroring another number",
+			summary:     "GH-orc-2: Crash",
+			number:      1,
+			key:         "OSASINFRA-5",
+			rewrite:     true,
+			wantErr:     true,
+			wantLinks:   map[int]string{},
+			wantSummary: "GH-orc-2: Crash",
+		},
+		{
+			name:        "summary mirroring another number, with force",
+			summary:     "[backport] GH-orc-2: Crash",
+			number:      1,
+			key:         "OSASINFRA-5",
+			rewrite:     true,
+			force:       true,
+			wantLinks:   map[int]string{1: "OSASINFRA-5"},
+			wantSummary: "GH-orc-1: [backport] Crash",
+		},
+		{
+			name:        "summary rewritten",
+			summary:     "Crash on boot (see GH-orc-2)",
+			number:      1,
+			key:         "OSASINFRA-5",
+			rewrite:     true,
+			wantLinks:   map[int]string{1: "OSASINFRA-5"},
+			wantSummary: "GH-orc-1: Crash on boot (see GH-orc-2)",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, client := newFakeJira(t, map[string]*fakeIssue{"OSASINFRA-5": {Summary: tc.summary}})
+			tracker := &jiratracker.Tracker{Client: client, Project: "OSASINFRA", SummaryPrefix: "GH-orc-"}
+			ctx := context.Background()
+			setLinks(t, fake, tc.links)
+
+			err := tracker.Link(ctx, tc.number, tc.key, tc.rewrite, tc.force)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if links, err := tracker.Links(ctx); err != nil || !maps.Equal(links, tc.wantLinks) {
+				t.Errorf("expected the links %v, got %v, %v", tc.wantLinks, links, err)
+			}
+			if summary := fake.issues["OSASINFRA-5"].Summary; summary != tc.wantSummary {
+				t.Errorf("expected the summary %q, got %q", tc.wantSummary, summary)
+			}
+		})
+	}
+}
+
+func TestUnlink(t *testing.T) {
+	for _, tc := range [...]struct {
+		name    string
+		links   map[int]string
+		summary string
+		rewrite bool
+
+		wantErr     bool
+		wantLinks   map[int]string
+		wantSummary string
+	}{
+		{
+			name:        "linked",
+			links:       map[int]string{1: "OSASINFRA-5", 2: "OSASINFRA-6"},
+			summary:     "Crash",
+			wantLinks:   map[int]string{2: "OSASINFRA-6"},
+			wantSummary: "Crash",
+		},
+		{
+			name:        "not linked",
+			links:       map[int]string{2: "OSASINFRA-6"},
+			summary:     "Crash",
+			wantErr:     true,
+			wantLinks:   map[int]string{2: "OSASINFRA-6"},
+			wantSummary: "Crash",
+		},
+		{
+			name:        "no links",
+			summary:     "GH-orc-1: Crash",
+			wantErr:     true,
+			wantLinks:   map[int]string{},
+			wantSummary: "GH-orc-1: Crash",
+		},
+		{
+			name:        "summary rewritten",
+			links:       map[int]string{1: "OSASINFRA-5"},
+			summary:     "[backport] GH-orc-1: Crash on boot",
+			rewrite:     true,
+			wantLinks:   map[int]string{},
+			wantSummary: "[backport] Crash on boot",
+		},
+		{
+			name:        "summary rewritten, not linked",
+			summary:     "GH-orc-1: Crash",
+			rewrite:     true,
+			wantLinks:   map[int]string{},
+			wantSummary: "Crash",
+		},
+		{
+			name:        "summary mirroring another number",
+			links:       map[int]string{1: "OSASINFRA-5"},
+			summary:     "GH-orc-2: Crash",
+			rewrite:     true,
+			wantErr:     true,
+			wantLinks:   map[int]string{1: "OSASINFRA-5"},
+			wantSummary: "GH-orc-2: Crash",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, client := newFakeJira(t, map[string]*fakeIssue{"OSASINFRA-5": {Summary: tc.summary}})
+			tracker := &jiratracker.Tracker{Client: client, Project: "OSASINFRA", SummaryPrefix: "GH-orc-"}
+			ctx := context.Background()
+			setLinks(t, fake, tc.links)
+
+			err := tracker.Unlink(ctx, 1, "OSASINFRA-5", tc.rewrite)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if links, err := tracker.Links(ctx); err != nil || !maps.Equal(links, tc.wantLinks) {
+				t.Errorf("expected the links %v, got %v, %v", tc.wantLinks, links, err)
+			}
+			if summary := fake.issues["OSASINFRA-5"].Summary; summary != tc.wantSummary {
+				t.Errorf("expected the summary %q, got %q", tc.wantSummary, summary)
+			}
+		})
+	}
+}
+
+func TestRelinkDropsLinks(t *testing.T) {
+	fake, client := newFakeJira(t, map[string]*fakeIssue{"OSASINFRA-5": {Summary: "Crash"}})
+	tracker := &jiratracker.Tracker{Client: client, Project: "OSASINFRA", SummaryPrefix: "GH-orc-"}
+	ctx := context.Background()
+	setLinks(t, fake, map[int]string{1: "OSASINFRA-5", 2: "OSASINFRA-6"})
+
+	if err := tracker.Relink(ctx, "OSASINFRA-5", github.Issue{Number: 7, Title: "Crash", URL: "https://github.com/o/other/issues/7"}); err != nil {
+		t.Fatal(err)
+	}
+	if links, err := tracker.Links(ctx); err != nil || !maps.Equal(links, map[int]string{2: "OSASINFRA-6"}) {
+		t.Errorf("expected the link to be dropped, got %v, %v", links, err)
+	}
+	if summary := fake.issues["OSASINFRA-5"].Summary; summary != "o/other#7: Crash" {
+		t.Errorf("expected the summary to reference the new location, got %q", summary)
+	}
+}
+
+// setLinks writes the links property, unless links is nil.
+func setLinks(t *testing.T, fake *fakeJira, links map[int]string) {
+	t.Helper()
+	if links == nil {
+		return
+	}
+	byNumber := make(map[string]string, len(links))
+	for n, key := range links {
+		byNumber[strconv.Itoa(n)] = key
+	}
+	value, err := json.Marshal(map[string]map[string]string{"GH-orc-": byNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.properties["OSASINFRA/ghira.links"] = value
+}
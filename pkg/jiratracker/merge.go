@@ -0,0 +1,186 @@
+package jiratracker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+const (
+	// duplicateResolution and duplicateLinkType are the names of the
+	// resolution and of the link type of the duplicate issues.
+	duplicateResolution = "Duplicate"
+	duplicateLinkType   = "Duplicate"
+
+	// closedTransition is the transition that closes an issue.
+	closedTransition = "Closed"
+)
+
+// Merge folds a duplicate issue into the canonical issue that mirrors the
+// same Github issue. The comments of the duplicate are copied to the
+// canonical issue, and its links are moved there. The duplicate is then
+// linked to the canonical issue and closed as a duplicate, so that it is no
+// longer recognised as a mirror.
+//
+// Merge can be run again, after a failure or on issues already merged: the
+// comments and the links that are already on the canonical issue are not
+// added twice.
+func (t *Tracker) Merge(ctx context.Context, canonical, duplicate string) error {
+	dup, response, err := t.Client.Issue.GetWithContext(ctx, duplicate, &jira.GetQueryOptions{Fields: "comment,issuelinks,status,resolution"})
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %w", duplicate, jira.NewJiraError(response, err))
+	}
+	canon, response, err := t.Client.Issue.GetWithContext(ctx, canonical, &jira.GetQueryOptions{Fields: "comment,issuelinks"})
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %w", canonical, jira.NewJiraError(response, err))
+	}
+
+	if err := t.copyComments(ctx, dup, canon); err != nil {
+		return err
+	}
+	if err := t.moveLinks(ctx, dup, canon); err != nil {
+		return err
+	}
+
+	// The inward issue "is duplicated by" the outward issue.
+	if !hasLink(canon, duplicateLinkType, canonical, duplicate) {
+		link := &jira.IssueLink{
+			Type:         jira.IssueLinkType{Name: duplicateLinkType},
+			InwardIssue:  &jira.Issue{Key: canonical},
+			OutwardIssue: &jira.Issue{Key: duplicate},
+		}
+		if response, err := t.Client.Issue.AddLinkWithContext(ctx, link); err != nil {
+			return fmt.Errorf("error linking %s to %s: %w", duplicate, canonical, jira.NewJiraError(response, err))
+		}
+	}
+
+	return t.closeAsDuplicate(ctx, dup)
+}
+
+// movedCommentHeader precedes the comments copied from a duplicate.
+func movedCommentHeader(duplicate string, c *jira.Comment) string {
+	return fmt.Sprintf("Moved from %s, where %s commented on %s:\n\n", duplicate, c.Author.DisplayName, c.Created)
+}
+
+func (t *Tracker) copyComments(ctx context.Context, dup, canon *jira.Issue) error {
+	if dup.Fields.Comments == nil {
+		return nil
+	}
+	existing := make(map[string]bool)
+	if canon.Fields.Comments != nil {
+		for _, c := range canon.Fields.Comments.Comments {
+			existing[c.Body] = true
+		}
+	}
+	for _, c := range dup.Fields.Comments.Comments {
+		body := movedCommentHeader(dup.Key, c) + c.Body
+		if existing[body] {
+			continue
+		}
+		if _, response, err := t.Client.Issue.AddCommentWithContext(ctx, canon.Key, &jira.Comment{Body: body}); err != nil {
+			return fmt.Errorf("error copying comment %s of %s: %w", c.ID, dup.Key, jira.NewJiraError(response, err))
+		}
+	}
+	return nil
+}
+
+// endpoints returns the inward and the outward issues of a link of the given
+// issue. The link only holds the other issue: when it is the outward issue,
+// the given issue is the inward issue, and conversely.
+func endpoints(key string, l *jira.IssueLink) (inward, outward string, ok bool) {
+	switch {
+	case l.OutwardIssue != nil:
+		return l.OutwardIssue.Key, key, true
+	case l.InwardIssue != nil:
+		return key, l.InwardIssue.Key, true
+	}
+	return "", "", false
+}
+
+// hasLink reports whether the issue has a link of the given type between the
+// given inward and outward issues.
+func hasLink(issue *jira.Issue, linkType, inward, outward string) bool {
+	for _, l := range issue.Fields.IssueLinks {
+		in, out, ok := endpoints(issue.Key, l)
+		if ok && l.Type.Name == linkType && in == inward && out == outward {
+			return true
+		}
+	}
+	return false
+}
+
+// moveLinks replaces the duplicate with the canonical issue in the links of
+// the duplicate. The links between the two issues are removed, except the
+// Duplicate link made by a previous Merge. The links that the canonical issue
+// already has are not added again.
+func (t *Tracker) moveLinks(ctx context.Context, dup, canon *jira.Issue) error {
+	for _, l := range dup.Fields.IssueLinks {
+		inward, outward, ok := endpoints(dup.Key, l)
+		if !ok {
+			continue
+		}
+		if l.Type.Name == duplicateLinkType && inward == canon.Key && outward == dup.Key {
+			continue
+		}
+
+		// The moved link replaces the duplicate with the canonical issue.
+		other := inward
+		if inward == dup.Key {
+			inward, other = canon.Key, outward
+		} else {
+			outward = canon.Key
+		}
+
+		if other != canon.Key && !hasLink(canon, l.Type.Name, inward, outward) {
+			moved := &jira.IssueLink{
+				Type:         jira.IssueLinkType{Name: l.Type.Name},
+				InwardIssue:  &jira.Issue{Key: inward},
+				OutwardIssue: &jira.Issue{Key: outward},
+			}
+			if response, err := t.Client.Issue.AddLinkWithContext(ctx, moved); err != nil {
+				return fmt.Errorf("error moving the %q link of %s to %s: %w", l.Type.Name, dup.Key, other, jira.NewJiraError(response, err))
+			}
+		}
+		if response, err := t.Client.Issue.DeleteLinkWithContext(ctx, l.ID); err != nil {
+			return fmt.Errorf("error removing the %q link of %s to %s: %w", l.Type.Name, dup.Key, other, jira.NewJiraError(response, err))
+		}
+	}
+	return nil
+}
+
+// closeAsDuplicate closes the issue with the Duplicate resolution. An issue
+// that is already closed only gets its resolution changed.
+func (t *Tracker) closeAsDuplicate(ctx context.Context, issue *jira.Issue) error {
+	resolution := map[string]any{"resolution": map[string]string{"name": duplicateResolution}}
+
+	if status := issue.Fields.Status; status != nil && status.Name == closedTransition {
+		if r := issue.Fields.Resolution; r != nil && r.Name == duplicateResolution {
+			return nil
+		}
+		if response, err := t.Client.Issue.UpdateIssueWithContext(ctx, issue.Key, map[string]any{"fields": resolution}); err != nil {
+			return fmt.Errorf("error resolving %s as a duplicate: %w", issue.Key, jira.NewJiraError(response, err))
+		}
+		return nil
+	}
+
+	transitions, response, err := t.Client.Issue.GetTransitionsWithContext(ctx, issue.Key)
+	if err != nil {
+		return fmt.Errorf("error fetching the transitions of %s: %w", issue.Key, jira.NewJiraError(response, err))
+	}
+	for _, tr := range transitions {
+		if !strings.EqualFold(tr.Name, closedTransition) {
+			continue
+		}
+		payload := map[string]any{
+			"transition": map[string]string{"id": tr.ID},
+			"fields":     resolution,
+		}
+		if response, err := t.Client.Issue.DoTransitionWithPayloadWithContext(ctx, issue.Key, payload); err != nil {
+			return fmt.Errorf("error closing %s: %w", issue.Key, jira.NewJiraError(response, err))
+		}
+		return nil
+	}
+	return fmt.Errorf("issue %s has no %q transition", issue.Key, closedTransition)
+}
@@ -0,0 +1,85 @@
+package jiratracker_test
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/shiftstack/ghira/pkg/jiratracker"
+)
+
+func TestMerge(t *testing.T) {
+	fake, client := newFakeJira(t, map[string]*fakeIssue{
+		"OSASINFRA-1": {Summary: "GH-orc-1: Crash", Status: "To Do", Comments: []string{"Looking into it"}},
+		"OSASINFRA-2": {Summary: "GH-orc-1: Crash", Status: "To Do", Comments: []string{"Same here"}},
+	})
+	// OSASINFRA-2 is blocked by OSASINFRA-3, relates to OSASINFRA-4,
+	// is cloned by OSASINFRA-5 like OSASINFRA-1 already is, and relates
+	// to OSASINFRA-1.
+	fake.AddLink(fakeLink{Type: "Blocks", Inward: "OSASINFRA-3", Outward: "OSASINFRA-2"})
+	fake.AddLink(fakeLink{Type: "Relates", Inward: "OSASINFRA-2", Outward: "OSASINFRA-4"})
+	fake.AddLink(fakeLink{Type: "Cloners", Inward: "OSASINFRA-5", Outward: "OSASINFRA-2"})
+	fake.AddLink(fakeLink{Type: "Cloners", Inward: "OSASINFRA-5", Outward: "OSASINFRA-1"})
+	fake.AddLink(fakeLink{Type: "Relates", Inward: "OSASINFRA-1", Outward: "OSASINFRA-2"})
+
+	tracker := &jiratracker.Tracker{Client: client, Project: "OSASINFRA", SummaryPrefix: "GH-orc-"}
+	ctx := context.Background()
+	if err := tracker.Merge(ctx, "OSASINFRA-1", "OSASINFRA-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[fakeLink]int{
+		{Type: "Blocks", Inward: "OSASINFRA-3", Outward: "OSASINFRA-1"}:    1,
+		{Type: "Relates", Inward: "OSASINFRA-1", Outward: "OSASINFRA-4"}:   1,
+		{Type: "Cloners", Inward: "OSASINFRA-5", Outward: "OSASINFRA-1"}:   1,
+		{Type: "Duplicate", Inward: "OSASINFRA-1", Outward: "OSASINFRA-2"}: 1,
+	}
+	if links := fake.Links(); !maps.Equal(links, want) {
+		t.Errorf("expected the links %v, got %v", want, links)
+	}
+	if changes := fake.Changes(); changes["POST /rest/api/2/issueLink"] != 3 {
+		t.Errorf("expected the links the canonical issue has to be skipped, got %d links created", changes["POST /rest/api/2/issueLink"])
+	}
+
+	canonical := fake.issues["OSASINFRA-1"]
+	if len(canonical.Comments) != 2 || !strings.HasPrefix(canonical.Comments[1], "Moved from OSASINFRA-2, where Alice commented") || !strings.HasSuffix(canonical.Comments[1], "\n\nSame here") {
+		t.Errorf("expected the comment to be copied, got %q", canonical.Comments)
+	}
+	if dup := fake.issues["OSASINFRA-2"]; dup.Status != "Closed" || dup.Resolution != "Duplicate" {
+		t.Errorf("expected the duplicate to be closed as Duplicate, got %s, %s", dup.Status, dup.Resolution)
+	}
+
+	// Merging again changes nothing.
+	before := fake.Changes()
+	if err := tracker.Merge(ctx, "OSASINFRA-1", "OSASINFRA-2"); err != nil {
+		t.Fatal(err)
+	}
+	if changes := fake.Changes(); !maps.Equal(changes, before) {
+		t.Errorf("expected no change, got %v after %v", changes, before)
+	}
+	if links := fake.Links(); !maps.Equal(links, want) {
+		t.Errorf("expected the links %v, got %v", want, links)
+	}
+	if canonical := fake.issues["OSASINFRA-1"]; len(canonical.Comments) != 2 {
+		t.Errorf("expected the comment to be copied once, got %q", canonical.Comments)
+	}
+}
+
+func TestMergeClosed(t *testing.T) {
+	fake, client := newFakeJira(t, map[string]*fakeIssue{
+		"OSASINFRA-1": {Summary: "GH-orc-1: Crash", Status: "To Do"},
+		"OSASINFRA-2": {Summary: "GH-orc-1: Crash", Status: "Closed", Resolution: "Done"},
+	})
+	tracker := &jiratracker.Tracker{Client: client, Project: "OSASINFRA", SummaryPrefix: "GH-orc-"}
+	if err := tracker.Merge(context.Background(), "OSASINFRA-1", "OSASINFRA-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if dup := fake.issues["OSASINFRA-2"]; dup.Status != "Closed" || dup.Resolution != "Duplicate" {
+		t.Errorf("expected the duplicate to be resolved as Duplicate, got %s, %s", dup.Status, dup.Resolution)
+	}
+	if changes := fake.Changes(); changes["POST /rest/api/2/issue/{key}/transitions"] != 0 {
+		t.Errorf("expected the closed duplicate not to be transitioned, got %v", changes)
+	}
+}
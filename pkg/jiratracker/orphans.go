@@ -0,0 +1,94 @@
+package jiratracker
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/shiftstack/ghira/pkg/github"
+)
+
+// orphanProperty is the issue property that marks the orphaned issues.
+const orphanProperty = "ghira.orphan"
+
+// reference returns the short reference to a Github issue, such as
+// "owner/repo#123", or its URL if it can't be parsed.
+func reference(issue github.Issue) string {
+	path, ok := strings.CutPrefix(issue.URL, "https://github.com/")
+	if !ok {
+		return issue.URL
+	}
+	repository, number, ok := strings.Cut(path, "/issues/")
+	if !ok {
+		return issue.URL
+	}
+	return repository + "#" + number
+}
+
+// Relink replaces the summary and the description of the issue with those of
+// the transferred Github issue. The new summary starts with the reference to
+// the Github issue instead of SummaryPrefix, so that the issue is no longer
+// recognised as a mirror. Its link made with Link, if any, is removed.
+func (t *Tracker) Relink(ctx context.Context, key string, issue github.Issue) error {
+	update := map[string]any{
+		"summary":     reference(issue) + ": " + issue.Title,
+		"description": description(issue),
+	}
+	response, err := t.Client.Issue.UpdateIssueWithContext(ctx, key, map[string]any{"fields": update})
+	if err != nil {
+		return jira.NewJiraError(response, err)
+	}
+	return t.dropLinks(ctx, key)
+}
+
+// hasComment reports whether the issue already has a comment with the given
+// body.
+func (t *Tracker) hasComment(ctx context.Context, key, body string) (bool, error) {
+	issue, response, err := t.Client.Issue.GetWithContext(ctx, key, &jira.GetQueryOptions{Fields: "comment"})
+	if err != nil {
+		return false, fmt.Errorf("error fetching the comments: %w", jira.NewJiraError(response, err))
+	}
+	if issue.Fields == nil || issue.Fields.Comments == nil {
+		return false, nil
+	}
+	return slices.ContainsFunc(issue.Fields.Comments.Comments, func(c *jira.Comment) bool { return c.Body == body }), nil
+}
+
+// orphan is the value of the orphanProperty issue property.
+type orphan struct {
+	At time.Time `json:"at"`
+}
+
+func (t *Tracker) Orphaned(ctx context.Context, key string) (bool, error) {
+	return t.getProperty(ctx, key, orphanProperty, &orphan{})
+}
+
+// MarkOrphaned comments on the issue, labels it and marks it with the
+// orphanProperty, in that order. It can be run again after a failure: the
+// comment is not posted twice.
+func (t *Tracker) MarkOrphaned(ctx context.Context, key, comment, label string) error {
+	if comment != "" {
+		commented, err := t.hasComment(ctx, key, comment)
+		if err != nil {
+			return err
+		}
+		if commented {
+			comment = ""
+		}
+	}
+	if comment != "" {
+		if _, response, err := t.Client.Issue.AddCommentWithContext(ctx, key, &jira.Comment{Body: comment}); err != nil {
+			return fmt.Errorf("error commenting: %w", jira.NewJiraError(response, err))
+		}
+	}
+	if label != "" {
+		update := map[string]any{"update": map[string]any{"labels": []map[string]string{{"add": label}}}}
+		if response, err := t.Client.Issue.UpdateIssueWithContext(ctx, key, update); err != nil {
+			return fmt.Errorf("error labelling: %w", jira.NewJiraError(response, err))
+		}
+	}
+	return t.setProperty(ctx, key, orphanProperty, orphan{At: time.Now().UTC()})
+}
@@ -0,0 +1,519 @@
+// Package journal records the changes made by ghira in an append-only file,
+// before they are made, so that the changes that failed or were interrupted
+// are retried with a backoff. Changes that keep failing are set aside in a
+// dead-letter list, until they are retried or dropped by hand.
+package journal
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/reconcile"
+)
+
+const (
+	// MaxAttempts is the number of failures after which a change is
+	// dead-lettered.
+	MaxAttempts = 5
+
+	minBackoff = time.Minute
+	maxBackoff = time.Hour
+)
+
+// Entry states.
+const (
+	Pending = "pending"
+	Failed  = "failed"
+	Dead    = "dead"
+)
+
+// Reasons reported by Held.
+const (
+	ReasonBackoff = "backing off after a failure"
+	ReasonDead    = "dead-lettered after repeated failures"
+)
+
+// Entry is a change that was not completed.
+type Entry struct {
+	ID string
+	reconcile.Operation
+
+	// State is Pending while the change is in progress, Failed while it
+	// waits for a retry, and Dead once it failed MaxAttempts times.
+	State     string
+	Attempts  int
+	LastError string
+
+	// At is when the change was last attempted, and RetryAt when it can
+	// be retried.
+	At      time.Time
+	RetryAt time.Time
+}
+
+// record is a line of the journal file.
+type record struct {
+	ID    string    `json:"id,omitempty"`
+	Event string    `json:"event"`
+	At    time.Time `json:"at"`
+
+	// Set by "begin".
+	Op *operation `json:"op,omitempty"`
+
+	// Set by "fail".
+	Error    string    `json:"error,omitempty"`
+	Attempts int       `json:"attempts,omitempty"`
+	RetryAt  time.Time `json:"retry_at,omitzero"`
+	Dead     bool      `json:"dead,omitempty"`
+
+	// Set by "retry", "drop" and "resolve", which apply to all the
+	// entries of an issue.
+	Number int `json:"gh_number,omitempty"`
+}
+
+type operation struct {
+	Action string `json:"action"`
+	Number int    `json:"gh_number"`
+	Key    string `json:"jira_key,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ErrInUse is returned by Open when another process has the journal open.
+var ErrInUse = errors.New("the journal is in use by another ghira process")
+
+// Journal is an open journal file. It is safe for concurrent use.
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	entries map[string]*Entry
+
+	// lock is the lock file, held with flock(2) while the journal is
+	// open, so that no other process recovers or rewrites it.
+	lock *os.File
+}
+
+var _ reconcile.Journal = (*Journal)(nil)
+
+// Open opens the journal at path, creating it if needed. It fails with
+// ErrInUse if another process has it open: the journal is locked with the
+// file path+".lock" until Close. The changes left pending by a previous
+// process were interrupted: they are marked as failed, to be retried. The
+// file is compacted to the entries that are not done.
+func Open(path string) (*Journal, error) {
+	j := &Journal{path: path, entries: make(map[string]*Entry)}
+
+	if err := j.acquire(); err != nil {
+		return nil, err
+	}
+	if err := j.load(); err != nil {
+		j.lock.Close()
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	for _, e := range j.entries {
+		if e.State == Pending {
+			slog.Warn("Found an interrupted change", "gh_number", e.Number, "jira_key", e.Key, "action", e.Action)
+			j.apply(j.failure(e, errors.New("interrupted"), now))
+		}
+	}
+
+	if err := j.compact(); err != nil {
+		j.lock.Close()
+		return nil, fmt.Errorf("error compacting %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// Read returns the changes of the journal at path that are not done, by
+// Github number, without opening it: the journal is neither locked nor
+// changed, and the changes in progress are still Pending.
+func Read(path string) ([]Entry, error) {
+	j := &Journal{path: path, entries: make(map[string]*Entry)}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	return j.Entries(), nil
+}
+
+// acquire locks the journal, without waiting.
+func (j *Journal) acquire() error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o700); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(j.path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lock.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return fmt.Errorf("error locking %s: %w", j.path, ErrInUse)
+		}
+		return fmt.Errorf("error locking %s: %w", j.path, err)
+	}
+	j.lock = lock
+	return nil
+}
+
+// load reads the records of the file, if it exists.
+func (j *Journal) load() error {
+	f, err := os.Open(j.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A crash can leave the last line truncated.
+			slog.Warn("Ignoring an invalid journal record", "path", j.path, "line", line, "error", err)
+			continue
+		}
+		j.apply(rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading %s: %w", j.path, err)
+	}
+	return nil
+}
+
+// Compact rewrites the file with the entries that are not done, so that it
+// doesn't grow with the changes that succeeded.
+func (j *Journal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.compact(); err != nil {
+		return fmt.Errorf("error compacting %s: %w", j.path, err)
+	}
+	return nil
+}
+
+// compact rewrites the file with the current entries, and opens it for
+// appending in place of the previous file. The caller must hold the lock,
+// if the journal is in use.
+func (j *Journal) compact() error {
+	path := j.path
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := json.NewEncoder(tmp)
+	for _, e := range j.sortedEntries() {
+		op := operation{Action: e.Action, Number: e.Number, Key: e.Key, Detail: e.Detail}
+		if err := enc.Encode(record{ID: e.ID, Event: "begin", At: e.At, Op: &op}); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := enc.Encode(record{ID: e.ID, Event: "fail", At: e.At, Error: e.LastError, Attempts: e.Attempts, RetryAt: e.RetryAt, Dead: e.State == Dead}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if j.f != nil {
+		j.f.Close()
+	}
+	j.f = f
+	return nil
+}
+
+// Close closes the file and releases the lock.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.f.Close()
+	j.lock.Close()
+	return err
+}
+
+// apply updates the entries with a record.
+func (j *Journal) apply(rec record) {
+	switch rec.Event {
+	case "begin":
+		if rec.Op == nil {
+			return
+		}
+		j.entries[rec.ID] = &Entry{
+			ID:        rec.ID,
+			Operation: reconcile.Operation{Action: rec.Op.Action, Number: rec.Op.Number, Key: rec.Op.Key, Detail: rec.Op.Detail},
+			State:     Pending,
+			At:        rec.At,
+		}
+	case "done":
+		e, ok := j.entries[rec.ID]
+		if !ok {
+			return
+		}
+		// The change supersedes the earlier failures of the same
+		// action.
+		for id, other := range j.entries {
+			if other.Number == e.Number && other.Action == e.Action {
+				delete(j.entries, id)
+			}
+		}
+	case "fail":
+		e, ok := j.entries[rec.ID]
+		if !ok {
+			return
+		}
+		for id, other := range j.entries {
+			if id != e.ID && other.Number == e.Number && other.Action == e.Action && other.State != Pending {
+				delete(j.entries, id)
+			}
+		}
+		e.State = Failed
+		if rec.Dead {
+			e.State = Dead
+		}
+		e.Attempts, e.LastError, e.At, e.RetryAt = rec.Attempts, rec.Error, rec.At, rec.RetryAt
+	case "retry":
+		for _, e := range j.entries {
+			if e.Number == rec.Number && e.State == Dead {
+				e.State, e.Attempts, e.RetryAt = Failed, 0, rec.At
+			}
+		}
+	case "drop", "resolve":
+		for id, e := range j.entries {
+			if e.Number == rec.Number && e.State != Pending {
+				delete(j.entries, id)
+			}
+		}
+	}
+}
+
+// failure returns the record of a failed attempt of e. The attempts add up
+// with those of the earlier failures of the same action.
+func (j *Journal) failure(e *Entry, err error, at time.Time) record {
+	attempts := 1
+	for _, other := range j.entries {
+		if other.ID != e.ID && other.Number == e.Number && other.Action == e.Action && other.State != Pending {
+			attempts = max(attempts, other.Attempts+1)
+		}
+	}
+	return record{
+		ID:       e.ID,
+		Event:    "fail",
+		At:       at,
+		Error:    err.Error(),
+		Attempts: attempts,
+		RetryAt:  at.Add(backoff(attempts)),
+		Dead:     attempts >= MaxAttempts,
+	}
+}
+
+// backoff doubles the delay before each retry, from minBackoff to
+// maxBackoff.
+func backoff(attempts int) time.Duration {
+	d := minBackoff
+	for range attempts - 1 {
+		if d *= 2; d >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return d
+}
+
+// write appends a record to the file and flushes it to disk, then applies
+// it. The caller must hold the lock.
+func (j *Journal) write(rec record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := j.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.apply(rec)
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (j *Journal) Begin(op reconcile.Operation) (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	id := newID()
+	return id, j.write(record{
+		ID:    id,
+		Event: "begin",
+		At:    time.Now().UTC(),
+		Op:    &operation{Action: op.Action, Number: op.Number, Key: op.Key, Detail: op.Detail},
+	})
+}
+
+func (j *Journal) Done(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.write(record{ID: id, Event: "done", At: time.Now().UTC()})
+}
+
+func (j *Journal) Fail(id string, err error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	e, ok := j.entries[id]
+	if !ok {
+		return fmt.Errorf("unknown journal entry %s", id)
+	}
+	rec := j.failure(e, err, time.Now().UTC())
+	if rec.Dead {
+		slog.Error("Giving up on a change after repeated failures", "gh_number", e.Number, "jira_key", e.Key, "action", e.Action, "attempts", rec.Attempts)
+	}
+	return j.write(rec)
+}
+
+func (j *Journal) Held(number int) (string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	var backingOff bool
+	for _, e := range j.entries {
+		if e.Number != number {
+			continue
+		}
+		switch {
+		case e.State == Dead:
+			return ReasonDead, true
+		case e.State == Failed && e.RetryAt.After(now):
+			backingOff = true
+		}
+	}
+	if backingOff {
+		return ReasonBackoff, true
+	}
+	return "", false
+}
+
+// Due returns the Github issues with failed changes that can be retried at
+// now, in ascending order.
+func (j *Journal) Due(now time.Time) []int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var numbers []int
+	for _, e := range j.entries {
+		if e.State == Failed && !e.RetryAt.After(now) {
+			numbers = append(numbers, e.Number)
+		}
+	}
+	slices.Sort(numbers)
+	return slices.Compact(numbers)
+}
+
+// Entries returns the changes that are not done, by Github number.
+func (j *Journal) Entries() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make([]Entry, 0, len(j.entries))
+	for _, e := range j.sortedEntries() {
+		entries = append(entries, *e)
+	}
+	return entries
+}
+
+func (j *Journal) sortedEntries() []*Entry {
+	return slices.SortedFunc(maps.Values(j.entries), func(a, b *Entry) int {
+		return cmp.Or(cmp.Compare(a.Number, b.Number), a.At.Compare(b.At), cmp.Compare(a.ID, b.ID))
+	})
+}
+
+// Retry moves the dead-lettered changes of a Github issue back to the retry
+// queue, and returns how many there were.
+func (j *Journal) Retry(number int) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	n := j.count(number, func(e *Entry) bool { return e.State == Dead })
+	if n == 0 {
+		return 0, nil
+	}
+	return n, j.write(record{Event: "retry", At: time.Now().UTC(), Number: number})
+}
+
+// Drop forgets the failed and dead-lettered changes of a Github issue, and
+// returns how many there were.
+func (j *Journal) Drop(number int) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	n := j.count(number, func(e *Entry) bool { return e.State != Pending })
+	if n == 0 {
+		return 0, nil
+	}
+	return n, j.write(record{Event: "drop", At: time.Now().UTC(), Number: number})
+}
+
+// Resolve forgets the failed and dead-lettered changes of a Github issue
+// that was synced successfully since: they are no longer needed, whatever
+// their action.
+func (j *Journal) Resolve(number int) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.count(number, func(e *Entry) bool { return e.State != Pending }) == 0 {
+		return nil
+	}
+	return j.write(record{Event: "resolve", At: time.Now().UTC(), Number: number})
+}
+
+func (j *Journal) count(number int, match func(*Entry) bool) int {
+	var n int
+	for _, e := range j.entries {
+		if e.Number == number && match(e) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,236 @@
+package journal_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/github"
+	"github.com/shiftstack/ghira/pkg/journal"
+	"github.com/shiftstack/ghira/pkg/reconcile"
+	"github.com/shiftstack/ghira/pkg/reconcile/fake"
+)
+
+func open(t *testing.T, path string) *journal.Journal {
+	t.Helper()
+	j, err := journal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { j.Close() })
+	return j
+}
+
+func fail(t *testing.T, j *journal.Journal, op reconcile.Operation) {
+	t.Helper()
+	id, err := j.Begin(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Fail(id, errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournalRetryQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := open(t, path)
+	create := reconcile.Operation{Action: "create", Number: 1}
+
+	fail(t, j, create)
+	if reason, held := j.Held(1); !held || reason != journal.ReasonBackoff {
+		t.Errorf("expected #1 to be held for the backoff, got %q, %t", reason, held)
+	}
+	if due := j.Due(time.Now()); len(due) != 0 {
+		t.Errorf("expected no retry before the backoff, got %v", due)
+	}
+	if due := j.Due(time.Now().Add(2 * time.Minute)); !slices.Equal(due, []int{1}) {
+		t.Errorf("expected #1 to be due after the backoff, got %v", due)
+	}
+
+	for range journal.MaxAttempts - 1 {
+		fail(t, j, create)
+	}
+	entries := j.Entries()
+	if len(entries) != 1 || entries[0].State != journal.Dead || entries[0].Attempts != journal.MaxAttempts {
+		t.Fatalf("expected a single dead entry after %d attempts, got %+v", journal.MaxAttempts, entries)
+	}
+	if reason, held := j.Held(1); !held || reason != journal.ReasonDead {
+		t.Errorf("expected #1 to be dead-lettered, got %q, %t", reason, held)
+	}
+
+	// The state survives a restart.
+	j.Close()
+	j = open(t, path)
+	if entries := j.Entries(); len(entries) != 1 || entries[0].State != journal.Dead {
+		t.Fatalf("expected the dead entry to be reloaded, got %+v", entries)
+	}
+
+	if n, err := j.Retry(1); err != nil || n != 1 {
+		t.Fatalf("expected 1 entry to retry, got %d, %v", n, err)
+	}
+	if due := j.Due(time.Now()); !slices.Equal(due, []int{1}) {
+		t.Errorf("expected #1 to be due after a manual retry, got %v", due)
+	}
+
+	id, err := j.Begin(create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Done(id); err != nil {
+		t.Fatal(err)
+	}
+	if entries := j.Entries(); len(entries) != 0 {
+		t.Errorf("expected a successful change to clear the earlier failures, got %+v", entries)
+	}
+}
+
+func TestJournalDrop(t *testing.T) {
+	j := open(t, filepath.Join(t.TempDir(), "journal.jsonl"))
+	fail(t, j, reconcile.Operation{Action: "create", Number: 1})
+	fail(t, j, reconcile.Operation{Action: "transition", Number: 2, Key: "OSASINFRA-2", Detail: "Closed"})
+
+	if n, err := j.Drop(1); err != nil || n != 1 {
+		t.Fatalf("expected 1 entry to drop, got %d, %v", n, err)
+	}
+	if entries := j.Entries(); len(entries) != 1 || entries[0].Number != 2 {
+		t.Errorf("expected only #2 to be left, got %+v", entries)
+	}
+}
+
+func TestJournalInterrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := open(t, path)
+	if _, err := j.Begin(reconcile.Operation{Action: "create", Number: 1}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	// A crash can leave a truncated record.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"x","event":"be`)
+	f.Close()
+
+	j = open(t, path)
+	entries := j.Entries()
+	if len(entries) != 1 || entries[0].State != journal.Failed || entries[0].LastError != "interrupted" {
+		t.Fatalf("expected the interrupted change to be failed, got %+v", entries)
+	}
+}
+
+func TestJournalInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := open(t, path)
+	if _, err := j.Begin(reconcile.Operation{Action: "create", Number: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := journal.Open(path); !errors.Is(err, journal.ErrInUse) {
+		t.Fatalf("expected ErrInUse, got %v", err)
+	}
+
+	// Reading doesn't recover the change in progress.
+	entries, err := journal.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].State != journal.Pending {
+		t.Fatalf("expected the change to be pending, got %+v", entries)
+	}
+
+	// The journal is unlocked once closed.
+	j.Close()
+	open(t, path)
+}
+
+func TestReconcilerJournal(t *testing.T) {
+	j := open(t, filepath.Join(t.TempDir(), "journal.jsonl"))
+	tracker := &fake.Tracker{CreateErr: errors.New("boom")}
+	r := &reconcile.Reconciler{
+		Source:  &fake.Source{GithubIssues: []github.Issue{{Number: 1, Title: "Issue", Status: "open"}}},
+		Tracker: tracker,
+		Journal: j,
+	}
+
+	result, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Failures) != 1 {
+		t.Fatalf("expected the creation to fail, got %+v", result)
+	}
+	if entries := j.Entries(); len(entries) != 1 || entries[0].Action != "create" || entries[0].LastError != "boom" {
+		t.Fatalf("expected the failed creation to be journaled, got %+v", entries)
+	}
+
+	tracker.CreateErr = nil
+	result, err = r.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Reason != journal.ReasonBackoff || len(tracker.Created) != 0 {
+		t.Errorf("expected the issue to be skipped during the backoff, got %+v", result)
+	}
+}
+
+func TestReconcilerJournalResolve(t *testing.T) {
+	j := open(t, filepath.Join(t.TempDir(), "journal.jsonl"))
+	for range journal.MaxAttempts {
+		fail(t, j, reconcile.Operation{Action: "transition", Number: 1, Key: "OSASINFRA-1", Detail: "Closed"})
+	}
+	if _, err := j.Retry(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The issue was reopened since: the sync finds nothing to do, and the
+	// failed transition must not be retried forever.
+	r := &reconcile.Reconciler{
+		Source: &fake.Source{GithubIssues: []github.Issue{{Number: 1, Title: "Issue", Status: "open"}}},
+		Tracker: &fake.Tracker{Known: map[int]reconcile.KnownIssue{1: {
+			Key:       "OSASINFRA-1",
+			Project:   "OSASINFRA",
+			IssueType: "3",
+			Status:    reconcile.Status{ID: "1", Name: "To Do"},
+		}}},
+		Journal: j,
+	}
+	result, err := r.SyncIssue(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Reason != "up to date" {
+		t.Fatalf("expected #1 to be up to date, got %+v", result)
+	}
+	if due := j.Due(time.Now().Add(time.Hour)); len(due) != 0 {
+		t.Errorf("expected no retry after a successful sync, got %v", due)
+	}
+	if entries := j.Entries(); len(entries) != 0 {
+		t.Errorf("expected the successful sync to clear the failed transition, got %+v", entries)
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j := open(t, path)
+	fail(t, j, reconcile.Operation{Action: "create", Number: 1})
+	fail(t, j, reconcile.Operation{Action: "create", Number: 2})
+	if err := j.Resolve(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	j.Close()
+	j = open(t, path)
+	if entries := j.Entries(); len(entries) != 1 || entries[0].Number != 2 {
+		t.Errorf("expected only #2 to survive the compaction, got %+v", entries)
+	}
+}
@@ -0,0 +1,63 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/reconcile"
+)
+
+// filePollInterval is how often a busy file lock is tried again.
+const filePollInterval = time.Second
+
+// File is an advisory lock on a file, held with flock(2). The kernel releases
+// it when the process exits, even if it crashes.
+type File struct {
+	// Path is the lock file. It is created if missing.
+	Path string
+}
+
+var _ reconcile.Lock = (*File)(nil)
+
+// Acquire never cancels the returned context: the lock is held until it is
+// released, or until the process exits.
+func (l *File) Acquire(ctx context.Context) (context.Context, func(), error) {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0o700); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(l.Path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for waiting := false; ; waiting = true {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, nil, fmt.Errorf("error locking %s: %w", l.Path, err)
+		}
+		if !waiting {
+			slog.Info("Waiting for another ghira process to finish", "lock", l.Path)
+		}
+		select {
+		case <-time.After(filePollInterval):
+		case <-ctx.Done():
+			f.Close()
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	return ctx, func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,222 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/shiftstack/ghira/pkg/reconcile"
+)
+
+const (
+	// leaseProperty is the project property holding the lease.
+	//
+	// https://developer.atlassian.com/cloud/jira/platform/jira-entity-properties/
+	leaseProperty = "ghira.lease"
+
+	leasePollInterval = 5 * time.Second
+
+	// leaseSettleDelay is how long a new holder waits before checking
+	// that it won the lease.
+	leaseSettleDelay = 2 * time.Second
+)
+
+// JiraLease is a lease stored in a property of a Jira project, for the
+// replicas that don't share a file system. The holder renews it until it is
+// released; a lease that is not renewed expires after TTL, so that a crashed
+// holder doesn't block the others forever.
+//
+// Jira can't update a property conditionally. Instead, a new holder reads the
+// lease back after writing it: of the processes that write it at the same
+// time, only the last one proceeds.
+//
+// Writing project properties requires the "Administer Projects" permission.
+type JiraLease struct {
+	Client  *jira.Client
+	Project string
+	TTL     time.Duration
+
+	holderOnce sync.Once
+	holder     string
+}
+
+var _ reconcile.Lock = (*JiraLease)(nil)
+
+// ErrLeaseLost is the cause of the cancellation of the context returned by
+// JiraLease.Acquire, when another process took the lease over.
+var ErrLeaseLost = errors.New("the Jira lease was taken over by another process")
+
+type lease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// Holder identifies the process in the lease.
+func (l *JiraLease) Holder() string {
+	l.holderOnce.Do(func() {
+		hostname, _ := os.Hostname()
+		b := make([]byte, 4)
+		rand.Read(b)
+		l.holder = hostname + "-" + strconv.Itoa(os.Getpid()) + "-" + hex.EncodeToString(b)
+	})
+	return l.holder
+}
+
+func (l *JiraLease) url() string {
+	return "rest/api/2/project/" + l.Project + "/properties/" + leaseProperty
+}
+
+// get returns the current lease, or nil if there is none.
+func (l *JiraLease) get(ctx context.Context) (*lease, error) {
+	req, err := l.Client.NewRequestWithContext(ctx, http.MethodGet, l.url(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var property struct {
+		Value lease `json:"value"`
+	}
+	response, err := l.Client.Do(req, &property)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, jira.NewJiraError(response, err)
+	}
+	return &property.Value, nil
+}
+
+func (l *JiraLease) put(ctx context.Context) error {
+	req, err := l.Client.NewRequestWithContext(ctx, http.MethodPut, l.url(), lease{Holder: l.Holder(), Expires: time.Now().Add(l.TTL).UTC()})
+	if err != nil {
+		return err
+	}
+	response, err := l.Client.Do(req, nil)
+	if err != nil {
+		return jira.NewJiraError(response, err)
+	}
+	return nil
+}
+
+func (l *JiraLease) delete(ctx context.Context) error {
+	req, err := l.Client.NewRequestWithContext(ctx, http.MethodDelete, l.url(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := l.Client.Do(req, nil)
+	if err != nil && (response == nil || response.StatusCode != http.StatusNotFound) {
+		return jira.NewJiraError(response, err)
+	}
+	return nil
+}
+
+// tryAcquire takes the lease if it is free, expired or already held.
+func (l *JiraLease) tryAcquire(ctx context.Context) (bool, error) {
+	current, err := l.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	if current != nil && current.Holder != l.Holder() && time.Now().Before(current.Expires) {
+		return false, nil
+	}
+	if err := l.put(ctx); err != nil {
+		return false, err
+	}
+	if current != nil && current.Holder == l.Holder() {
+		return true, nil
+	}
+
+	select {
+	case <-time.After(leaseSettleDelay):
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	confirmed, err := l.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	return confirmed != nil && confirmed.Holder == l.Holder(), nil
+}
+
+// Acquire takes the lease and renews it in the background. Before each
+// renewal, it checks that the lease is still held: the returned context is
+// cancelled if another process took it over, or if it could not be renewed.
+func (l *JiraLease) Acquire(ctx context.Context) (context.Context, func(), error) {
+	for waiting := false; ; waiting = true {
+		acquired, err := l.tryAcquire(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error acquiring the Jira lease: %w", err)
+		}
+		if acquired {
+			break
+		}
+		if !waiting {
+			slog.Info("Waiting for another ghira replica to release the Jira lease", "project", l.Project)
+		}
+		select {
+		case <-time.After(leasePollInterval):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	locked, lose := context.WithCancelCause(ctx)
+	renewCtx, stopRenewing := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(l.TTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := l.renew(renewCtx); err != nil && renewCtx.Err() == nil {
+					slog.Error("Lost the Jira lease: stopping the changes", "error", err)
+					lose(err)
+					return
+				}
+			case <-renewCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return locked, func() {
+		stopRenewing()
+		<-done
+		lose(context.Canceled)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		current, err := l.get(ctx)
+		if err == nil && current != nil && current.Holder == l.Holder() {
+			err = l.delete(ctx)
+		}
+		if err != nil {
+			slog.Error("Unable to release the Jira lease: it will expire", "error", err, "ttl", l.TTL)
+		}
+	}, nil
+}
+
+// renew extends the lease, after checking that no other process took it over.
+func (l *JiraLease) renew(ctx context.Context) error {
+	current, err := l.get(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading the Jira lease: %w", err)
+	}
+	if current == nil || current.Holder != l.Holder() {
+		return ErrLeaseLost
+	}
+	if err := l.put(ctx); err != nil {
+		return fmt.Errorf("error renewing the Jira lease: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+// Package lock keeps several ghira processes from making changes at the same
+// time: a file lock covers the processes of a host, and a lease stored in
+// Jira covers the replicas running on different hosts.
+package lock
+
+import (
+	"context"
+
+	"github.com/shiftstack/ghira/pkg/reconcile"
+)
+
+// All acquires all the locks, in order, and releases them in the reverse
+// order.
+type All []reconcile.Lock
+
+var _ reconcile.Lock = All(nil)
+
+func (locks All) Acquire(ctx context.Context) (context.Context, func(), error) {
+	releases := make([]func(), 0, len(locks))
+	releaseAll := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+	for _, l := range locks {
+		locked, release, err := l.Acquire(ctx)
+		if err != nil {
+			releaseAll()
+			return nil, nil, err
+		}
+		ctx = locked
+		releases = append(releases, release)
+	}
+	return ctx, releaseAll, nil
+}
@@ -0,0 +1,140 @@
+package lock_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/shiftstack/ghira/pkg/lock"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ghira.lock")
+	l := &lock.File{Path: path}
+
+	_, release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := (&lock.File{Path: path}).Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the lock to be busy, got %v", err)
+	}
+
+	release()
+	_, release, err = (&lock.File{Path: path}).Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("expected the released lock to be free, got %v", err)
+	}
+	release()
+}
+
+// propertyServer serves a single Jira entity property.
+type propertyServer struct {
+	mu    sync.Mutex
+	value json.RawMessage
+}
+
+func (s *propertyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		if s.value == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"key": "ghira.lease", "value": s.value})
+	case http.MethodPut:
+		s.value, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		s.value = nil
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestJiraLease(t *testing.T) {
+	property := &propertyServer{}
+	server := httptest.NewServer(property)
+	defer server.Close()
+	client, err := jira.NewClient(server.Client(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &lock.JiraLease{Client: client, Project: "OSASINFRA", TTL: time.Minute}
+	_, release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	other := &lock.JiraLease{Client: client, Project: "OSASINFRA", TTL: time.Minute}
+	if _, _, err := other.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the lease to be held, got %v", err)
+	}
+
+	// The holder can take the lease again without waiting.
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, again, err := l.Acquire(ctx)
+	if err != nil {
+		t.Fatalf("expected the holder to renew the lease, got %v", err)
+	}
+	again()
+
+	release()
+	if property.value != nil {
+		t.Errorf("expected the lease to be deleted, got %s", property.value)
+	}
+}
+
+func TestJiraLeaseLost(t *testing.T) {
+	property := &propertyServer{}
+	server := httptest.NewServer(property)
+	defer server.Close()
+	client, err := jira.NewClient(server.Client(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &lock.JiraLease{Client: client, Project: "OSASINFRA", TTL: 300 * time.Millisecond}
+	locked, release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// Another replica takes the lease over, for example after a pause
+	// longer than the TTL.
+	property.mu.Lock()
+	property.value = json.RawMessage(`{"holder":"other","expires":"2100-01-01T00:00:00Z"}`)
+	property.mu.Unlock()
+
+	select {
+	case <-locked.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the context to be cancelled when the lease is lost")
+	}
+	if cause := context.Cause(locked); !errors.Is(cause, lock.ErrLeaseLost) {
+		t.Errorf("expected the lease to be lost, got %v", cause)
+	}
+	property.mu.Lock()
+	defer property.mu.Unlock()
+	if string(property.value) != `{"holder":"other","expires":"2100-01-01T00:00:00Z"}` {
+		t.Errorf("expected the lease of the other replica to be left alone, got %s", property.value)
+	}
+}
@@ -0,0 +1,195 @@
+// Package metrics exposes Prometheus metrics about the sync runs and the
+// Github and Jira API calls.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const namespace = "ghira"
+
+// Registry holds all the ghira metrics, plus the Go runtime and process
+// metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	issuesSeen = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "issues_seen_total",
+		Help:      "Github issues seen by the sync runs.",
+	})
+	issuesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "issues_created_total",
+		Help:      "Jira issues created.",
+	})
+	issuesTransitioned = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "issues_transitioned_total",
+		Help:      "Jira issues transitioned.",
+	})
+	issuesUpdated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "issues_updated_total",
+		Help:      "Existing issues whose fields were updated.",
+	})
+	issuesSkipped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "issues_skipped_total",
+		Help:      "Github issues that needed no change, or could not be changed.",
+	})
+	issuesFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "issues_failed_total",
+		Help:      "Github issues that could not be reconciled.",
+	})
+
+	runs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runs_total",
+		Help:      `Sync runs, by result: "success", "partial" (some issues failed) or "error" (the run did not complete).`,
+	}, []string{"result"})
+	runDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_duration_seconds",
+		Help:      "Duration of the last sync run.",
+	})
+	lastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Time of the end of the last sync run that completed without failures.",
+	})
+
+	apiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_requests_total",
+		Help:      `Requests sent to the Github and Jira APIs, by status code ("error" for network errors).`,
+	}, []string{"service", "method", "code"})
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of the requests to the Github and Jira APIs, until the response headers are received.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"service", "method"})
+	rateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_remaining",
+		Help:      `Requests remaining in the current rate-limit window, as last reported by the API, by resource (the X-RateLimit-Resource header of Github, such as "core" or "graphql"; empty for Jira).`,
+	}, []string{"service", "resource"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		issuesSeen,
+		issuesCreated,
+		issuesTransitioned,
+		issuesUpdated,
+		issuesSkipped,
+		issuesFailed,
+		runs,
+		runDuration,
+		lastSuccess,
+		apiRequests,
+		apiRequestDuration,
+		rateLimitRemaining,
+	)
+}
+
+// Run is the outcome of a sync run.
+type Run struct {
+	Seen         int
+	Created      int
+	Transitioned int
+	Updated      int
+	Skipped      int
+	Failed       int
+
+	// Err is the error returned by the run, if any.
+	Err      error
+	Duration time.Duration
+}
+
+// ObserveRun records the outcome of a sync run.
+func ObserveRun(run Run) {
+	ObserveSync(run)
+	runDuration.Set(run.Duration.Seconds())
+
+	switch {
+	case run.Err != nil:
+		runs.WithLabelValues("error").Inc()
+	case run.Failed > 0:
+		runs.WithLabelValues("partial").Inc()
+	default:
+		runs.WithLabelValues("success").Inc()
+		lastSuccess.SetToCurrentTime()
+	}
+}
+
+// ObserveSync records the outcome of the sync of single issues, triggered by
+// a webhook or a retry: only the issue counters are updated.
+func ObserveSync(run Run) {
+	issuesSeen.Add(float64(run.Seen))
+	issuesCreated.Add(float64(run.Created))
+	issuesTransitioned.Add(float64(run.Transitioned))
+	issuesUpdated.Add(float64(run.Updated))
+	issuesSkipped.Add(float64(run.Skipped))
+	issuesFailed.Add(float64(run.Failed))
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// WriteTextfile writes the metrics to path, for the node_exporter textfile
+// collector. The file is replaced atomically.
+func WriteTextfile(path string) error {
+	return prometheus.WriteToTextfile(path, Registry)
+}
+
+// Push replaces the metrics of the "ghira" job on the Pushgateway at url.
+func Push(url string) error {
+	return push.New(url, namespace).Gatherer(Registry).Push()
+}
+
+// Transport counts and times the requests sent to an API, and records the
+// rate limit it reports, by resource. It should sit below the retry and cache
+// layers, so that it observes every request that reaches the network.
+type Transport struct {
+	// Service is the "service" label of the metrics.
+	Service string
+
+	// Transport is the underlying RoundTripper. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	start := time.Now()
+	res, err := transport.RoundTrip(req)
+	apiRequestDuration.WithLabelValues(t.Service, req.Method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		apiRequests.WithLabelValues(t.Service, req.Method, "error").Inc()
+		return nil, err
+	}
+
+	apiRequests.WithLabelValues(t.Service, req.Method, strconv.Itoa(res.StatusCode)).Inc()
+	if remaining, err := strconv.ParseFloat(res.Header.Get("X-RateLimit-Remaining"), 64); err == nil {
+		rateLimitRemaining.WithLabelValues(t.Service, res.Header.Get("X-RateLimit-Resource")).Set(remaining)
+	}
+	return res, nil
+}
@@ -0,0 +1,309 @@
+// Package fake provides in-memory implementations of the reconcile
+// interfaces, for tests.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/shiftstack/ghira/pkg/github"
+	"github.com/shiftstack/ghira/pkg/reconcile"
+)
+
+// Source serves a fixed list of Github issues.
+type Source struct {
+	GithubIssues []github.Issue
+
+	// Err, when set, is returned after all the issues are served.
+	Err error
+}
+
+var _ reconcile.Source = (*Source)(nil)
+
+func (s *Source) Issues(ctx context.Context) (<-chan github.Issue, <-chan error) {
+	issueCh := make(chan github.Issue)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(issueCh)
+		defer close(errCh)
+		for _, issue := range s.GithubIssues {
+			select {
+			case issueCh <- issue:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+		if s.Err != nil {
+			errCh <- s.Err
+		}
+	}()
+	return issueCh, errCh
+}
+
+func (s *Source) Issue(_ context.Context, number int) (github.Issue, error) {
+	for _, issue := range s.GithubIssues {
+		if issue.Number == number {
+			return issue, nil
+		}
+	}
+	return github.Issue{}, fmt.Errorf("issue %d not found", number)
+}
+
+// TransitionCall records a call to Tracker.DoTransition.
+type TransitionCall struct {
+	Key string
+	To  string
+}
+
+// Tracker is an in-memory tracker. Its workflow lets any issue transition
+// to any of the statuses in Workflow, except the status it is in. Created
+// issues get keys in the form "FAKE-<n>".
+type Tracker struct {
+	// Known are the issues already mirrored, indexed by Github number.
+	Known map[int]reconcile.KnownIssue
+
+	// Unlisted are mirrored issues that KnownIssues doesn't return, as if
+	// another process created them after the listing.
+	Unlisted map[int]reconcile.KnownIssue
+
+	// Workflow lists the statuses the issues can be transitioned to.
+	Workflow []reconcile.Status
+
+	// Errors, when set, are returned by the corresponding method.
+	CreateErr      error
+	TransitionsErr error
+
+	mu sync.Mutex
+
+	// Created records the Github issues passed to Create, in call order.
+	Created []github.Issue
+
+	// Transitioned records the calls to DoTransition, in call order.
+	Transitioned []TransitionCall
+
+	// TransitionsCalls counts the calls to Transitions.
+	TransitionsCalls int
+
+	// Updated records the calls to UpdateFields, in call order.
+	Updated []UpdateCall
+
+	// Synced holds the values recorded by SetSyncedFields, indexed by
+	// key.
+	Synced map[string]reconcile.FieldValues
+
+	// Relinked records the calls to Relink, in call order.
+	Relinked []RelinkCall
+
+	// MarkedOrphans records the calls to MarkOrphaned, in call order.
+	MarkedOrphans []OrphanCall
+}
+
+// RelinkCall records a call to Tracker.Relink.
+type RelinkCall struct {
+	Key string
+	URL string
+}
+
+// OrphanCall records a call to Tracker.MarkOrphaned.
+type OrphanCall struct {
+	Key     string
+	Comment string
+	Label   string
+}
+
+// UpdateCall records a call to Tracker.UpdateFields or Github.UpdateIssue.
+type UpdateCall struct {
+	Key    string
+	Number int
+	Fields []string
+}
+
+var _ reconcile.Tracker = (*Tracker)(nil)
+
+func (t *Tracker) KnownIssues(context.Context) (map[int]reconcile.KnownIssue, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	known := make(map[int]reconcile.KnownIssue, len(t.Known))
+	for n, issue := range t.Known {
+		known[n] = issue
+	}
+	return known, nil
+}
+
+func (t *Tracker) KnownIssue(_ context.Context, number int) (reconcile.KnownIssue, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if issue, ok := t.Known[number]; ok {
+		return issue, true, nil
+	}
+	issue, ok := t.Unlisted[number]
+	return issue, ok, nil
+}
+
+func (t *Tracker) Create(_ context.Context, issue github.Issue) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.CreateErr != nil {
+		return "", t.CreateErr
+	}
+
+	t.Created = append(t.Created, issue)
+	key := "FAKE-" + strconv.Itoa(len(t.Created))
+	if t.Known == nil {
+		t.Known = make(map[int]reconcile.KnownIssue)
+	}
+	t.Known[issue.Number] = reconcile.KnownIssue{Key: key}
+	return key, nil
+}
+
+func (t *Tracker) Transitions(_ context.Context, issue reconcile.KnownIssue) ([]reconcile.Transition, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.TransitionsCalls++
+	if t.TransitionsErr != nil {
+		return nil, t.TransitionsErr
+	}
+
+	var transitions []reconcile.Transition
+	for _, status := range t.Workflow {
+		if status.ID != issue.Status.ID {
+			transitions = append(transitions, reconcile.Transition{ID: status.ID, Name: status.Name})
+		}
+	}
+	return transitions, nil
+}
+
+func (t *Tracker) DoTransition(_ context.Context, key, transitionID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, status := range t.Workflow {
+		if status.ID != transitionID {
+			continue
+		}
+		for _, issues := range []map[int]reconcile.KnownIssue{t.Known, t.Unlisted} {
+			for n, issue := range issues {
+				if issue.Key == key {
+					issue.Status = status
+					issues[n] = issue
+					t.Transitioned = append(t.Transitioned, TransitionCall{Key: key, To: status.Name})
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("issue %s not found", key)
+	}
+	return fmt.Errorf("transition %s not found", transitionID)
+}
+
+func (t *Tracker) UpdateFields(_ context.Context, key string, issue github.Issue, fields []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Updated = append(t.Updated, UpdateCall{Key: key, Number: issue.Number, Fields: fields})
+	return nil
+}
+
+func (t *Tracker) SyncedFields(_ context.Context, key string) (reconcile.FieldValues, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return maps.Clone(t.Synced[key]), nil
+}
+
+func (t *Tracker) SetSyncedFields(_ context.Context, key string, values reconcile.FieldValues) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.Synced == nil {
+		t.Synced = make(map[string]reconcile.FieldValues)
+	}
+	t.Synced[key] = maps.Clone(values)
+	return nil
+}
+
+func (t *Tracker) Relink(_ context.Context, key string, issue github.Issue) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Relinked = append(t.Relinked, RelinkCall{Key: key, URL: issue.URL})
+	return nil
+}
+
+func (t *Tracker) Orphaned(_ context.Context, key string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return slices.ContainsFunc(t.MarkedOrphans, func(c OrphanCall) bool { return c.Key == key }), nil
+}
+
+func (t *Tracker) MarkOrphaned(_ context.Context, key, comment, label string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.MarkedOrphans = append(t.MarkedOrphans, OrphanCall{Key: key, Comment: comment, Label: label})
+	return nil
+}
+
+// Github records the updates of Github issues, and locates the issues
+// missing from the listing.
+type Github struct {
+	mu sync.Mutex
+
+	// Locations are returned by Locate, indexed by Github number. The
+	// issues that are not listed are still in the repository.
+	Locations map[int]github.Location
+
+	// Located records the numbers passed to Locate, in call order.
+	Located []int
+
+	// Updated records the calls to UpdateIssue, in call order.
+	Updated []UpdateCall
+
+	// Updates holds the updates, in call order.
+	Updates []github.IssueUpdate
+}
+
+var (
+	_ reconcile.Github  = (*Github)(nil)
+	_ reconcile.Locator = (*Github)(nil)
+)
+
+func (g *Github) Locate(_ context.Context, number int) (github.Location, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.Located = append(g.Located, number)
+	return g.Locations[number], nil
+}
+
+func (g *Github) UpdateIssue(_ context.Context, number int, update github.IssueUpdate) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var fields []string
+	for field, set := range map[string]bool{
+		"summary":     update.Title != nil,
+		"description": update.Body != nil,
+		"status":      update.State != nil,
+		"assignee":    update.Assignees != nil,
+		"labels":      update.Labels != nil,
+		"fixVersion":  update.Milestone != nil,
+	} {
+		if set {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+	g.Updated = append(g.Updated, UpdateCall{Number: number, Fields: fields})
+	g.Updates = append(g.Updates, update)
+	return nil
+}
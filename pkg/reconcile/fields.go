@@ -0,0 +1,165 @@
+package reconcile
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/shiftstack/bugwatcher/pkg/team"
+	"github.com/shiftstack/ghira/pkg/config"
+	"github.com/shiftstack/ghira/pkg/github"
+)
+
+// FieldValues are the values of the synced fields of an issue, indexed by
+// field name (see config.FieldNames). Values are normalised so that the
+// values of both sides can be compared: the status is "open" or "closed",
+// the assignee is a Github handle, the labels are sorted and separated by
+// commas, and so are the fix versions of a Jira issue, which can have several
+// (see fixVersion).
+type FieldValues map[string]string
+
+// Conflict is a field that changed on both sides since it was last synced.
+// It is left alone until the values are reconciled by hand.
+type Conflict struct {
+	Number int
+	Key    string
+	Field  string
+
+	Github string
+	Jira   string
+	Synced string
+}
+
+// direction is the way a field must be synced.
+type direction int
+
+const (
+	inSync direction = iota
+	toJira
+	toGithub
+	conflicting
+)
+
+// decide returns the way a field owned by owner must be synced. synced is the
+// value recorded at the last sync, if known.
+//
+// A field that changed on both sides since the last sync is a conflict,
+// whoever the owner. Otherwise the value of the owner wins; with the
+// last-writer-wins policy, the value of the side that changed wins.
+func decide(owner config.Owner, githubValue, jiraValue, synced string, known bool) direction {
+	if githubValue == jiraValue {
+		return inSync
+	}
+	if known && githubValue != synced && jiraValue != synced {
+		return conflicting
+	}
+	switch owner {
+	case config.OwnerGithub:
+		return toJira
+	case config.OwnerJira:
+		return toGithub
+	}
+	switch {
+	case !known:
+		// Without history, there is no telling which side wrote last.
+		return conflicting
+	case githubValue != synced:
+		return toJira
+	default:
+		return toGithub
+	}
+}
+
+// jiraLabel replaces the spaces, which Jira labels can't contain.
+func jiraLabel(name string) string {
+	return strings.ReplaceAll(name, " ", "_")
+}
+
+// fixVersion returns the fix version to compare with the Github milestone,
+// among the fix versions of a Jira issue: a Github issue can only have one
+// milestone. It is the milestone if it is one of them, or else the first one.
+func fixVersion(milestone, versions string) string {
+	all := strings.Split(versions, ",")
+	if slices.Contains(all, milestone) {
+		return milestone
+	}
+	return all[0]
+}
+
+// githubFields returns the field values of a Github issue.
+func githubFields(issue github.Issue) FieldValues {
+	labels := make([]string, 0, len(issue.Labels))
+	for _, l := range issue.Labels {
+		labels = append(labels, jiraLabel(l.Name))
+	}
+	slices.Sort(labels)
+
+	values := FieldValues{
+		"summary":     issue.Title,
+		"description": issue.Body,
+		"assignee":    issue.Assignee.Handle,
+		"status":      issue.Status,
+		"labels":      strings.Join(labels, ","),
+	}
+	if issue.Milestone != nil {
+		values["fixVersion"] = issue.Milestone.Title
+	}
+	return values
+}
+
+// jiraFields returns the field values of a tracker issue. Jira assignees who
+// are not in the team are prefixed with "jira:", as they have no Github
+// handle.
+func jiraFields(issue KnownIssue, people []team.Person) FieldValues {
+	values := maps.Clone(issue.Fields)
+	if values == nil {
+		values = make(FieldValues)
+	}
+
+	values["status"] = "open"
+	if issue.Status.Name == "Closed" {
+		values["status"] = "closed"
+	}
+
+	if accountID := values["assignee"]; accountID != "" {
+		if person, ok := team.PersonByJiraAccountID(people, accountID); ok {
+			values["assignee"] = person.Github
+		} else {
+			values["assignee"] = "jira:" + accountID
+		}
+	}
+	return values
+}
+
+// githubUpdate returns the update that sets the given fields of a Github
+// issue to the Jira values. The description is not written back: the Jira
+// description is the text rendering of the Markdown body. The labels keep the
+// Jira form, which the Github client maps back to the labels of the
+// repository.
+func githubUpdate(values FieldValues, fields []string) github.IssueUpdate {
+	var update github.IssueUpdate
+	for _, field := range fields {
+		value := values[field]
+		switch field {
+		case "summary":
+			update.Title = &value
+		case "status":
+			update.State = &value
+		case "assignee":
+			assignees := []string{}
+			if value != "" {
+				assignees = append(assignees, value)
+			}
+			update.Assignees = &assignees
+		case "labels":
+			labels := []string{}
+			if value != "" {
+				labels = strings.Split(value, ",")
+			}
+			update.Labels = &labels
+		case "fixVersion":
+			update.Milestone = &value
+		}
+	}
+	return update
+}
@@ -0,0 +1,150 @@
+package reconcile
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/github"
+)
+
+// Orphan reasons.
+const (
+	OrphanTransferred = "transferred"
+	OrphanDeleted     = "deleted"
+)
+
+// Locator finds out what became of the Github issues that are missing from
+// the listing.
+type Locator interface {
+	Locate(ctx context.Context, number int) (github.Location, error)
+}
+
+// Orphan is a tracker issue whose Github issue is missing from the listing.
+type Orphan struct {
+	Number int
+	Key    string
+
+	// Reason is OrphanTransferred or OrphanDeleted.
+	Reason string
+
+	// URL is the new location of a transferred issue.
+	URL string
+}
+
+// checkOrphans looks up the known issues that were not listed by the source.
+// The tracker issues of the transferred issues are relinked to their new
+// location; those of the deleted issues get the configured orphan actions.
+func (r *Reconciler) checkOrphans(ctx context.Context, alreadyKnown map[int]KnownIssue, listed map[int]bool, result *Result) error {
+	for _, number := range slices.SortedFunc(maps.Keys(alreadyKnown), cmp.Compare) {
+		if listed[number] {
+			continue
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("run interrupted: %w", ctx.Err())
+		}
+		if _, held := r.held(number); held {
+			continue
+		}
+		jiraIssue := alreadyKnown[number]
+		if r.gone[jiraIssue.Key] || r.labelledOrphan(jiraIssue) {
+			// Already handled: the deleted Github issue is only
+			// reported again when there are no orphan actions.
+			if r.Orphans == nil {
+				result.Orphans = append(result.Orphans, Orphan{Number: number, Key: jiraIssue.Key, Reason: OrphanDeleted})
+			}
+			continue
+		}
+		if err := r.checkOrphan(context.WithoutCancel(ctx), number, jiraIssue, result); err != nil {
+			result.Failures = append(result.Failures, Failure{Number: number, Key: jiraIssue.Key, Err: err})
+		}
+	}
+	return nil
+}
+
+// labelledOrphan reports whether the tracker issue has the orphan label. The
+// label is added after the other actions, so the issue was handled.
+func (r *Reconciler) labelledOrphan(jiraIssue KnownIssue) bool {
+	if r.Orphans == nil || r.Orphans.Label == "" {
+		return false
+	}
+	return slices.Contains(strings.Split(jiraIssue.Fields["labels"], ","), r.Orphans.Label)
+}
+
+// markGone records that the Github issue of a tracker issue was deleted, and
+// that the orphan actions, if any, were applied.
+func (r *Reconciler) markGone(key string) {
+	if r.gone == nil {
+		r.gone = make(map[string]bool)
+	}
+	r.gone[key] = true
+}
+
+func (r *Reconciler) checkOrphan(ctx context.Context, number int, jiraIssue KnownIssue, result *Result) error {
+	logger := issueLogger(number).With("jira_key", jiraIssue.Key, "action", "orphan")
+
+	location, err := r.Locator.Locate(ctx, number)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case location.Moved != nil:
+		moved := *location.Moved
+		start := time.Now()
+		op := Operation{Action: "relink", Number: number, Key: jiraIssue.Key, Detail: moved.URL}
+		if err := r.journaled(op, func() error { return r.Tracker.Relink(ctx, jiraIssue.Key, moved) }); err != nil {
+			logger.Error("Unable to relink the Jira issue to the transferred Github issue", "url", moved.URL, "error", err, "duration", time.Since(start))
+			return fmt.Errorf("error relinking to %s: %w", moved.URL, err)
+		}
+		logger.Info("Relinked the Jira issue to the transferred Github issue", "url", moved.URL, "duration", time.Since(start))
+		result.Orphans = append(result.Orphans, Orphan{Number: number, Key: jiraIssue.Key, Reason: OrphanTransferred, URL: moved.URL})
+
+	case location.Gone:
+		if r.Orphans == nil {
+			r.markGone(jiraIssue.Key)
+			logger.Warn("The Github issue was deleted")
+			result.Orphans = append(result.Orphans, Orphan{Number: number, Key: jiraIssue.Key, Reason: OrphanDeleted})
+			return nil
+		}
+
+		// The actions are only applied once.
+		handled, err := r.Tracker.Orphaned(ctx, jiraIssue.Key)
+		if err != nil {
+			return fmt.Errorf("error checking whether the orphan was handled: %w", err)
+		}
+		if handled {
+			r.markGone(jiraIssue.Key)
+			logger.Debug("Skipping the orphan, which was already handled")
+			return nil
+		}
+
+		// The issue is closed first: the mark records that all the
+		// actions were applied.
+		if r.Orphans.Close && jiraIssue.Status.Name != "Closed" {
+			outcome := Outcome{Number: number, Key: jiraIssue.Key}
+			if _, err := r.transition(ctx, jiraIssue, "Closed", &outcome, logger); err != nil {
+				return err
+			}
+		}
+		start := time.Now()
+		op := Operation{Action: "orphan", Number: number, Key: jiraIssue.Key}
+		if err := r.journaled(op, func() error {
+			return r.Tracker.MarkOrphaned(ctx, jiraIssue.Key, r.Orphans.Comment, r.Orphans.Label)
+		}); err != nil {
+			logger.Error("Unable to mark the Jira issue as orphaned", "error", err, "duration", time.Since(start))
+			return fmt.Errorf("error marking as orphaned: %w", err)
+		}
+		r.markGone(jiraIssue.Key)
+		logger.Warn("The Github issue was deleted: marked the Jira issue as orphaned", "duration", time.Since(start))
+		result.Orphans = append(result.Orphans, Orphan{Number: number, Key: jiraIssue.Key, Reason: OrphanDeleted})
+
+	default:
+		logger.Debug("The Github issue was not listed, but still exists")
+	}
+	return nil
+}
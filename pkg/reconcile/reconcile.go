@@ -0,0 +1,851 @@
+// Package reconcile mirrors the issues of a source (Github) into a tracker
+// (Jira).
+package reconcile
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shiftstack/bugwatcher/pkg/team"
+	"github.com/shiftstack/ghira/pkg/config"
+	"github.com/shiftstack/ghira/pkg/github"
+)
+
+// Source lists the issues to mirror.
+type Source interface {
+	// Issues streams all the issues of the repository, open and closed.
+	// The error channel receives at most one error and is closed before
+	// the issue channel.
+	Issues(ctx context.Context) (<-chan github.Issue, <-chan error)
+
+	// Issue fetches a single issue.
+	Issue(ctx context.Context, number int) (github.Issue, error)
+}
+
+// Tracker is where the issues are mirrored.
+type Tracker interface {
+	// KnownIssues returns the issues already mirrored in the tracker,
+	// indexed by Github issue number.
+	KnownIssues(ctx context.Context) (map[int]KnownIssue, error)
+
+	// KnownIssue returns the issue mirroring the given Github issue, and
+	// whether it exists.
+	KnownIssue(ctx context.Context, number int) (KnownIssue, bool, error)
+
+	// Create mirrors a Github issue and returns the key of the new issue.
+	Create(ctx context.Context, issue github.Issue) (string, error)
+
+	// Transitions returns the workflow transitions available to the issue.
+	Transitions(ctx context.Context, issue KnownIssue) ([]Transition, error)
+
+	// DoTransition applies a transition to the issue with the given key.
+	DoTransition(ctx context.Context, key, transitionID string) error
+
+	// UpdateFields copies the given fields of a Github issue to the issue
+	// with the given key. The status is changed with transitions instead.
+	UpdateFields(ctx context.Context, key string, issue github.Issue, fields []string) error
+
+	// SyncedFields returns the field values recorded at the last sync of
+	// the issue with the given key, or nil if none were recorded.
+	SyncedFields(ctx context.Context, key string) (FieldValues, error)
+
+	// SetSyncedFields records the field values of the issue with the
+	// given key after a sync.
+	SetSyncedFields(ctx context.Context, key string, values FieldValues) error
+
+	// Relink points the issue with the given key to a Github issue that
+	// was transferred to another repository. The issue no longer mirrors
+	// a Github issue of the repository.
+	Relink(ctx context.Context, key string, issue github.Issue) error
+
+	// Orphaned reports whether the issue with the given key was marked as
+	// orphaned.
+	Orphaned(ctx context.Context, key string) (bool, error)
+
+	// MarkOrphaned marks the issue with the given key as orphaned, after
+	// posting comment and adding label, unless they are empty.
+	MarkOrphaned(ctx context.Context, key, comment, label string) error
+}
+
+// Github updates the Github issues whose fields are owned by Jira.
+type Github interface {
+	UpdateIssue(ctx context.Context, number int, update github.IssueUpdate) error
+}
+
+// Journal records the changes before they are made, so that the changes that
+// failed or were interrupted can be retried.
+type Journal interface {
+	// Begin records a change about to be made, and returns its ID.
+	Begin(op Operation) (string, error)
+
+	// Done records that the change with the given ID was made.
+	Done(id string) error
+
+	// Fail records that the change with the given ID failed.
+	Fail(id string, err error) error
+
+	// Held reports whether the changes to a Github issue are on hold
+	// after repeated failures, and why.
+	Held(number int) (string, bool)
+
+	// Resolve records that a Github issue was synced successfully, so
+	// that its earlier failures are not retried.
+	Resolve(number int) error
+}
+
+// Lock excludes the other ghira processes while the reconciler makes changes.
+type Lock interface {
+	// Acquire waits for the lock until ctx is done, and returns the
+	// function that releases it. The returned context is derived from ctx,
+	// and is cancelled if the lock is lost before it is released, so that
+	// no new change is started without it.
+	Acquire(ctx context.Context) (locked context.Context, release func(), err error)
+}
+
+// Operation is a change to an issue.
+type Operation struct {
+	// Action is "create", "transition", "update_jira", "update_github",
+	// "record_synced", "relink" or "orphan".
+	Action string
+	Number int
+	Key    string
+
+	// Detail describes the change, such as the transition or the fields
+	// to update.
+	Detail string
+}
+
+// Status is a workflow status of the tracker.
+type Status struct {
+	ID   string
+	Name string
+}
+
+// KnownIssue is a tracker issue that mirrors a Github issue.
+type KnownIssue struct {
+	Key       string
+	Project   string
+	IssueType string
+	Status    Status
+
+	// Fields holds the values of the synced fields other than the
+	// status, as in FieldValues except for the assignee, which is a Jira
+	// account ID.
+	Fields FieldValues
+
+	// Duplicates are the keys of the other issues that mirror the same
+	// Github issue. The issue itself is the one to sync, as chosen by the
+	// tracker.
+	Duplicates []string
+}
+
+// Duplicate is a Github issue mirrored by several tracker issues.
+type Duplicate struct {
+	Number int
+
+	// Key is the issue that is synced, and Duplicates are the others.
+	Key        string
+	Duplicates []string
+}
+
+// Transition is a workflow transition. Transitions are looked up by name; in
+// the OSASINFRA workflow, they are named after their destination status.
+type Transition struct {
+	ID   string
+	Name string
+}
+
+// Failure is a Github issue that could not be reconciled.
+type Failure struct {
+	Number int
+	// Key is empty if the issue does not exist in the tracker.
+	Key string
+	Err error
+}
+
+func (f Failure) Error() string {
+	if f.Key == "" {
+		return fmt.Sprintf("issue #%d: %v", f.Number, f.Err)
+	}
+	return fmt.Sprintf("issue #%d (%s): %v", f.Number, f.Key, f.Err)
+}
+
+func (f Failure) Unwrap() error { return f.Err }
+
+// Outcome records what a run did to a Github issue.
+type Outcome struct {
+	Number int
+	Title  string
+	URL    string
+	Key    string
+
+	// From and To are the statuses of a transition.
+	From string
+	To   string
+
+	// Fields lists the fields that were updated, on either side.
+	Fields []string
+
+	// Reason explains why an issue was skipped.
+	Reason string
+}
+
+func newOutcome(issue github.Issue, key string) Outcome {
+	return Outcome{
+		Number: issue.Number,
+		Title:  issue.Title,
+		URL:    issue.URL,
+		Key:    key,
+	}
+}
+
+// Result summarises a run. All lists are in ascending Github number order.
+type Result struct {
+	Seen int
+
+	Created      []Outcome
+	Transitioned []Outcome
+	// Updated lists the existing issues whose fields were updated.
+	Updated []Outcome
+	Skipped []Outcome
+
+	// Failures are the issues that could not be reconciled.
+	Failures []Failure
+
+	// Conflicts are the fields that changed on both sides since they were
+	// last synced, and were left alone.
+	Conflicts []Conflict
+
+	// Duplicates are the Github issues mirrored by several tracker issues.
+	// Only one of the tracker issues is synced.
+	Duplicates []Duplicate
+
+	// Orphans are the tracker issues whose Github issue was transferred
+	// or deleted.
+	Orphans []Orphan
+
+	// UnmatchedUsers are the Github authors and assignees who are not in
+	// the team, in alphabetical order.
+	UnmatchedUsers []string
+}
+
+func (r *Result) sort() {
+	byNumber := func(a, b Outcome) int { return cmp.Compare(a.Number, b.Number) }
+	slices.SortFunc(r.Created, byNumber)
+	slices.SortFunc(r.Transitioned, byNumber)
+	slices.SortFunc(r.Updated, byNumber)
+	slices.SortFunc(r.Skipped, byNumber)
+	slices.SortFunc(r.Failures, func(a, b Failure) int { return cmp.Compare(a.Number, b.Number) })
+	slices.SortStableFunc(r.Conflicts, func(a, b Conflict) int { return cmp.Compare(a.Number, b.Number) })
+	slices.SortFunc(r.Duplicates, func(a, b Duplicate) int { return cmp.Compare(a.Number, b.Number) })
+	slices.SortFunc(r.Orphans, func(a, b Orphan) int { return cmp.Compare(a.Number, b.Number) })
+	slices.Sort(r.UnmatchedUsers)
+	r.UnmatchedUsers = slices.Compact(r.UnmatchedUsers)
+}
+
+// addExisting records the outcome of the sync of an existing issue. An issue
+// can be both transitioned and updated; it is skipped if neither happened.
+func (r *Result) addExisting(outcome Outcome, conflicts []Conflict, err error) {
+	r.Conflicts = append(r.Conflicts, conflicts...)
+	switch {
+	case err != nil:
+		r.Failures = append(r.Failures, Failure{Number: outcome.Number, Key: outcome.Key, Err: err})
+	case outcome.To == "" && len(outcome.Fields) == 0:
+		r.Skipped = append(r.Skipped, outcome)
+	default:
+		if outcome.To != "" {
+			r.Transitioned = append(r.Transitioned, outcome)
+		}
+		if len(outcome.Fields) > 0 {
+			r.Updated = append(r.Updated, outcome)
+		}
+	}
+}
+
+// addDuplicates records the tracker issues that duplicate known.
+func (r *Result) addDuplicates(number int, known KnownIssue) {
+	if len(known.Duplicates) == 0 {
+		return
+	}
+	issueLogger(number).Warn("Found several Jira issues for the Github issue", "action", "duplicate", "jira_key", known.Key, "duplicates", known.Duplicates)
+	r.Duplicates = append(r.Duplicates, Duplicate{Number: number, Key: known.Key, Duplicates: known.Duplicates})
+}
+
+// unmatchedUsers returns the handles of the issue that could not be resolved
+// to a Jira account.
+func unmatchedUsers(issue github.Issue) []string {
+	var unmatched []string
+	if issue.Author.Handle != "" && issue.Author.JiraAccountID == "" {
+		unmatched = append(unmatched, issue.Author.Handle)
+	}
+	if issue.Assignee.Handle != "" && issue.Assignee.JiraAccountID == "" {
+		unmatched = append(unmatched, issue.Assignee.Handle)
+	}
+	return unmatched
+}
+
+// Reconciler creates the tracker issues that are missing, and syncs the
+// fields of the existing ones with their Github counterpart.
+type Reconciler struct {
+	Source  Source
+	Tracker Tracker
+
+	// Github receives the values of the fields owned by Jira. It is only
+	// needed if Fields gives some fields to Jira or to the last writer.
+	Github Github
+
+	// Fields declares the owner of each synced field. The status is owned
+	// by Github unless stated otherwise; the other fields are not synced
+	// unless listed. When Fields is not empty, the values of the listed
+	// fields are recorded in the tracker after each sync, to detect the
+	// conflicts.
+	Fields map[string]config.Owner
+
+	// ReverseStatus is set when the reverse sync closes and reopens the
+	// Github issues, with a state reason and a comment. The runs then
+	// leave the Github status alone, even when Jira owns it.
+	ReverseStatus bool
+
+	// People maps Github handles to Jira accounts.
+	People []team.Person
+
+	// Concurrency is the number of existing issues that are processed
+	// concurrently. Values lower than 1 are treated as 1.
+	Concurrency int
+
+	// Journal, if set, records the changes. The issues it holds after
+	// repeated failures are skipped.
+	Journal Journal
+
+	// Locator, if set, looks up the known issues that the source didn't
+	// list, to find the transferred and the deleted ones.
+	Locator Locator
+
+	// Orphans configures what is done to the tracker issues whose Github
+	// issue was deleted. If nil, they are only reported.
+	Orphans *config.Orphans
+
+	// Lock, if set, is held during the runs and the single-issue syncs,
+	// so that other processes don't make changes at the same time.
+	Lock Lock
+
+	transitionsOnce sync.Once
+	transitions     *transitionCache
+
+	// gone holds the keys of the tracker issues whose Github issue was
+	// found deleted, which is final, so that they are not looked up again.
+	gone map[string]bool
+
+	// running serialises the runs and the single-issue syncs, so that an
+	// issue can't be created twice.
+	running sync.Mutex
+}
+
+func (r *Reconciler) init() {
+	r.transitionsOnce.Do(func() { r.transitions = newTransitionCache(r.Tracker) })
+}
+
+// Run reconciles all the issues of the source.
+//
+// Existing issues are reconciled concurrently. New issues are created
+// afterwards, one at a time in ascending Github number order, so that
+// tracker keys follow the order of the Github issues. Then, if a Locator is
+// set, the known issues that the source didn't list are checked for orphans.
+//
+// Errors affecting a single issue are collected in the result and don't stop
+// the run. The returned error is only set when the run could not complete;
+// the result then covers the issues processed so far.
+//
+// When ctx is cancelled, no new issue is started, but the issues in flight
+// are finished: their tracker calls are only bounded by the timeouts of the
+// underlying clients.
+func (r *Reconciler) Run(ctx context.Context) (result Result, err error) {
+	r.init()
+	r.running.Lock()
+	defer r.running.Unlock()
+
+	ctx, release, err := r.acquire(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer release()
+	defer result.sort()
+
+	// Stop the source if the run is aborted before consuming all issues.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workCtx := context.WithoutCancel(ctx)
+
+	issues, sourceErr := r.Source.Issues(ctx)
+
+	alreadyKnown, err := r.Tracker.KnownIssues(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("error building the index of known issues: %w", err)
+	}
+
+	slog.Info("Indexed the known issues", "count", len(alreadyKnown))
+	slog.Debug("Known issues", "gh_numbers", slices.Sorted(maps.Keys(alreadyKnown)))
+	for n, known := range alreadyKnown {
+		result.addDuplicates(n, known)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		toCreate []github.Issue
+		listed   = make(map[int]bool)
+	)
+	resolvedIssues := ResolveNames(issues, r.People)
+	for range max(r.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for issue := range resolvedIssues {
+				if ctx.Err() != nil {
+					// Drain the channel so that the source can exit.
+					continue
+				}
+
+				mu.Lock()
+				result.Seen++
+				listed[issue.Number] = true
+				result.UnmatchedUsers = append(result.UnmatchedUsers, unmatchedUsers(issue)...)
+				mu.Unlock()
+
+				if reason, held := r.held(issue.Number); held {
+					mu.Lock()
+					result.Skipped = append(result.Skipped, Outcome{Number: issue.Number, Title: issue.Title, URL: issue.URL, Key: alreadyKnown[issue.Number].Key, Reason: reason})
+					mu.Unlock()
+					continue
+				}
+
+				jiraIssue, issueExistsInJira := alreadyKnown[issue.Number]
+				if !issueExistsInJira {
+					mu.Lock()
+					toCreate = append(toCreate, issue)
+					mu.Unlock()
+					continue
+				}
+				outcome, conflicts, err := r.syncExistingIssue(workCtx, issue, jiraIssue, issueLogger(issue.Number).With("jira_key", jiraIssue.Key))
+
+				mu.Lock()
+				result.addExisting(outcome, conflicts, err)
+				mu.Unlock()
+				r.resolve(issue.Number, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The error channel is closed once the issue channel is drained.
+	if err := <-sourceErr; err != nil {
+		if ctx.Err() != nil {
+			return result, fmt.Errorf("run interrupted: %w", context.Cause(ctx))
+		}
+		return result, err
+	}
+
+	slices.SortFunc(toCreate, func(a, b github.Issue) int { return cmp.Compare(a.Number, b.Number) })
+	for _, issue := range toCreate {
+		if ctx.Err() != nil {
+			return result, fmt.Errorf("run interrupted: %w", context.Cause(ctx))
+		}
+		r.createMissing(workCtx, issue, &result)
+	}
+
+	if r.Locator != nil {
+		if err := r.checkOrphans(ctx, alreadyKnown, listed, &result); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// SyncIssue reconciles a single Github issue: it creates its tracker issue if
+// it is missing, or syncs its fields otherwise. It waits for any run in
+// progress to finish.
+//
+// As in Run, errors affecting the issue are reported in the result, and the
+// returned error is only set when the issue could not be looked up.
+func (r *Reconciler) SyncIssue(ctx context.Context, number int) (result Result, err error) {
+	r.init()
+	r.running.Lock()
+	defer r.running.Unlock()
+
+	ctx, release, err := r.acquire(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer release()
+
+	issue, err := r.Source.Issue(ctx, number)
+	if err != nil {
+		return Result{}, err
+	}
+	issues := make(chan github.Issue, 1)
+	issues <- issue
+	close(issues)
+	issue = <-ResolveNames(issues, r.People)
+
+	result.Seen = 1
+	result.UnmatchedUsers = unmatchedUsers(issue)
+	slices.Sort(result.UnmatchedUsers)
+
+	if reason, held := r.held(number); held {
+		result.Skipped = append(result.Skipped, Outcome{Number: issue.Number, Title: issue.Title, URL: issue.URL, Reason: reason})
+		return result, nil
+	}
+
+	jiraIssue, issueExistsInJira, err := r.Tracker.KnownIssue(ctx, number)
+	if err != nil {
+		return result, fmt.Errorf("error looking up the tracker issue: %w", err)
+	}
+
+	if ctx.Err() != nil {
+		return result, fmt.Errorf("sync interrupted: %w", context.Cause(ctx))
+	}
+	workCtx := context.WithoutCancel(ctx)
+	if !issueExistsInJira {
+		r.createMissing(workCtx, issue, &result)
+		return result, nil
+	}
+	result.addDuplicates(number, jiraIssue)
+
+	outcome, conflicts, err := r.syncExistingIssue(workCtx, issue, jiraIssue, issueLogger(issue.Number).With("jira_key", jiraIssue.Key))
+	result.addExisting(outcome, conflicts, err)
+	r.resolve(number, err)
+	return result, nil
+}
+
+// acquire takes the lock, if any, and returns the context to make the
+// changes with: it is cancelled if the lock is lost.
+func (r *Reconciler) acquire(ctx context.Context) (context.Context, func(), error) {
+	if r.Lock == nil {
+		return ctx, func() {}, nil
+	}
+	locked, release, err := r.Lock.Acquire(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error acquiring the lock: %w", err)
+	}
+	return locked, release, nil
+}
+
+// createMissing mirrors a Github issue in the tracker and records the outcome
+// in result. It first checks that the tracker issue still doesn't exist: if
+// it was created by another process since the issues were listed, it is
+// synced instead.
+func (r *Reconciler) createMissing(ctx context.Context, issue github.Issue, result *Result) {
+	jiraIssue, exists, err := r.Tracker.KnownIssue(ctx, issue.Number)
+	if err != nil {
+		result.Failures = append(result.Failures, Failure{Number: issue.Number, Err: fmt.Errorf("error checking whether the Jira issue exists: %w", err)})
+		return
+	}
+	if exists {
+		logger := issueLogger(issue.Number).With("jira_key", jiraIssue.Key)
+		logger.Warn("The Jira issue was created by another process: syncing it instead", "action", "create")
+		result.addDuplicates(issue.Number, jiraIssue)
+		outcome, conflicts, err := r.syncExistingIssue(ctx, issue, jiraIssue, logger)
+		result.addExisting(outcome, conflicts, err)
+		r.resolve(issue.Number, err)
+		return
+	}
+
+	key, err := r.create(ctx, issue)
+	if err != nil {
+		result.Failures = append(result.Failures, Failure{Number: issue.Number, Err: err})
+		return
+	}
+	result.Created = append(result.Created, newOutcome(issue, key))
+	r.resolve(issue.Number, nil)
+}
+
+// create mirrors a Github issue in the tracker and returns its key.
+func (r *Reconciler) create(ctx context.Context, issue github.Issue) (string, error) {
+	logger := issueLogger(issue.Number).With("action", "create")
+	logger.Debug("Processing Github issue", "assignee", issue.Assignee.Handle, "status", issue.Status)
+
+	start := time.Now()
+	var key string
+	err := r.journaled(Operation{Action: "create", Number: issue.Number}, func() (err error) {
+		key, err = r.Tracker.Create(ctx, issue)
+		return err
+	})
+	if err != nil {
+		logger.Error("Unable to create Jira issue", "error", err, "duration", time.Since(start))
+		return "", fmt.Errorf("error creating Jira issue: %w", err)
+	}
+
+	logger.Info("Created Jira issue", "jira_key", key, "duration", time.Since(start))
+	return key, nil
+}
+
+// journaled records the change made by do in the journal, if any. The change
+// is not made if it can't be recorded.
+func (r *Reconciler) journaled(op Operation, do func() error) error {
+	if r.Journal == nil {
+		return do()
+	}
+
+	id, err := r.Journal.Begin(op)
+	if err != nil {
+		return fmt.Errorf("error recording the %s in the journal: %w", op.Action, err)
+	}
+	if err := do(); err != nil {
+		if journalErr := r.Journal.Fail(id, err); journalErr != nil {
+			issueLogger(op.Number).Error("Unable to record the failure in the journal", "error", journalErr)
+		}
+		return err
+	}
+	if err := r.Journal.Done(id); err != nil {
+		// The change is made: it would be retried, which is harmless.
+		issueLogger(op.Number).Error("Unable to record the change in the journal", "error", err)
+	}
+	return nil
+}
+
+// resolve clears the earlier failures of an issue from the journal, if any,
+// once the issue was synced without error. A successful sync can make no
+// change, and so record no "done" change that would clear them.
+func (r *Reconciler) resolve(number int, err error) {
+	if r.Journal == nil || err != nil {
+		return
+	}
+	if err := r.Journal.Resolve(number); err != nil {
+		issueLogger(number).Error("Unable to record the sync in the journal", "error", err)
+	}
+}
+
+// held reports whether the journal holds the changes to a Github issue.
+func (r *Reconciler) held(number int) (string, bool) {
+	if r.Journal == nil {
+		return "", false
+	}
+	reason, held := r.Journal.Held(number)
+	if held {
+		issueLogger(number).Debug("Skipping issue", "action", "skip", "reason", reason)
+	}
+	return reason, held
+}
+
+// ResolveNames resolves Github handles to Jira account IDs.
+func ResolveNames(issues <-chan github.Issue, teamMembers []team.Person) <-chan github.Issue {
+	out := make(chan github.Issue)
+
+	go func() {
+		defer close(out)
+
+		for i := range issues {
+			if i.Author.Handle != "" {
+				if author, ok := team.PersonByGithubHandle(teamMembers, i.Author.Handle); ok {
+					i.Author.JiraAccountID = author.JiraAccountID
+				}
+			}
+
+			if i.Assignee.Handle != "" {
+				if assignee, ok := team.PersonByGithubHandle(teamMembers, i.Assignee.Handle); ok {
+					i.Assignee.JiraAccountID = assignee.JiraAccountID
+				}
+			}
+
+			out <- i
+		}
+	}()
+	return out
+}
+
+// issueLogger returns a logger that tags every record with the Github issue
+// it relates to.
+func issueLogger(number int) *slog.Logger {
+	return slog.With("gh_number", number)
+}
+
+// syncExistingIssue syncs the fields of the Jira issue and of its Github
+// counterpart, each way according to the owner of the field. Transitions
+// are only looked up when the Jira status must change. The outcome lists the
+// updated fields and the transition; if neither happened, it holds the reason
+// why the issue was skipped.
+func (r *Reconciler) syncExistingIssue(ctx context.Context, issue github.Issue, jiraIssue KnownIssue, logger *slog.Logger) (Outcome, []Conflict, error) {
+	logger.Debug("Processing Github issue", "assignee", issue.Assignee.Handle, "status", issue.Status, "jira_status", jiraIssue.Status.Name)
+
+	outcome := newOutcome(issue, jiraIssue.Key)
+	githubValues, jiraValues := githubFields(issue), jiraFields(jiraIssue, r.People)
+	jiraValues["fixVersion"] = fixVersion(githubValues["fixVersion"], jiraValues["fixVersion"])
+
+	var synced FieldValues
+	if len(r.Fields) > 0 {
+		var err error
+		if synced, err = r.Tracker.SyncedFields(ctx, jiraIssue.Key); err != nil {
+			logger.Error("Unable to fetch the synced values", "error", err)
+			return outcome, nil, fmt.Errorf("error fetching the synced values: %w", err)
+		}
+	}
+	next := maps.Clone(synced)
+	if next == nil {
+		next = make(FieldValues)
+	}
+
+	var (
+		jiraFieldUpdates, githubFieldUpdates []string
+		transitionTo                         string
+		conflicts                            []Conflict
+	)
+	for _, field := range config.FieldNames {
+		owner, tracked := r.Fields[field]
+		if !tracked {
+			if field != "status" {
+				continue
+			}
+			owner = config.OwnerGithub
+		}
+		githubValue, jiraValue := githubValues[field], jiraValues[field]
+		syncedValue, known := synced[field]
+
+		switch decide(owner, githubValue, jiraValue, syncedValue, known) {
+		case inSync:
+			if tracked {
+				next[field] = githubValue
+			}
+		case toJira:
+			switch {
+			case field == "status" && githubValue == "closed":
+				transitionTo = "Closed"
+			case field == "status":
+				transitionTo = "To Do"
+			case field == "assignee" && githubValue != "" && issue.Assignee.JiraAccountID == "":
+				logger.Warn("The Github assignee is not in the team: not assigning in Jira", "assignee", githubValue)
+			default:
+				jiraFieldUpdates = append(jiraFieldUpdates, field)
+			}
+		case toGithub:
+			if field == "status" && r.ReverseStatus {
+				logger.Debug("The Github status is left to the reverse sync", "github", githubValue, "jira", jiraValue)
+				continue
+			}
+			if field == "assignee" && strings.HasPrefix(jiraValue, "jira:") {
+				logger.Warn("The Jira assignee is not in the team: not assigning on Github", "assignee", strings.TrimPrefix(jiraValue, "jira:"))
+				continue
+			}
+			githubFieldUpdates = append(githubFieldUpdates, field)
+		case conflicting:
+			logger.Warn("Conflicting changes", "action", "conflict", "field", field, "github", githubValue, "jira", jiraValue, "synced", syncedValue)
+			conflicts = append(conflicts, Conflict{
+				Number: issue.Number,
+				Key:    jiraIssue.Key,
+				Field:  field,
+				Github: githubValue,
+				Jira:   jiraValue,
+				Synced: syncedValue,
+			})
+		}
+	}
+
+	if len(jiraFieldUpdates) > 0 {
+		start := time.Now()
+		op := Operation{Action: "update_jira", Number: issue.Number, Key: jiraIssue.Key, Detail: strings.Join(jiraFieldUpdates, ",")}
+		if err := r.journaled(op, func() error { return r.Tracker.UpdateFields(ctx, jiraIssue.Key, issue, jiraFieldUpdates) }); err != nil {
+			logger.Error("Unable to update Jira issue", "action", "update", "fields", jiraFieldUpdates, "error", err, "duration", time.Since(start))
+			return outcome, conflicts, fmt.Errorf("error updating %s in Jira: %w", strings.Join(jiraFieldUpdates, ", "), err)
+		}
+		logger.Info("Updated Jira issue", "action", "update", "fields", jiraFieldUpdates, "duration", time.Since(start))
+		for _, field := range jiraFieldUpdates {
+			next[field] = githubValues[field]
+		}
+		outcome.Fields = append(outcome.Fields, jiraFieldUpdates...)
+	}
+
+	if transitionTo != "" {
+		transitioned, err := r.transition(ctx, jiraIssue, transitionTo, &outcome, logger)
+		if err != nil {
+			return outcome, conflicts, err
+		}
+		if transitioned {
+			next["status"] = githubValues["status"]
+		}
+	}
+
+	if len(githubFieldUpdates) > 0 {
+		if r.Github == nil {
+			return outcome, conflicts, fmt.Errorf("unable to update %s on Github: no Github client", strings.Join(githubFieldUpdates, ", "))
+		}
+		start := time.Now()
+		op := Operation{Action: "update_github", Number: issue.Number, Key: jiraIssue.Key, Detail: strings.Join(githubFieldUpdates, ",")}
+		if err := r.journaled(op, func() error {
+			return r.Github.UpdateIssue(ctx, issue.Number, githubUpdate(jiraValues, githubFieldUpdates))
+		}); err != nil {
+			logger.Error("Unable to update Github issue", "action", "update", "fields", githubFieldUpdates, "error", err, "duration", time.Since(start))
+			return outcome, conflicts, fmt.Errorf("error updating %s on Github: %w", strings.Join(githubFieldUpdates, ", "), err)
+		}
+		logger.Info("Updated Github issue", "action", "update", "fields", githubFieldUpdates, "duration", time.Since(start))
+		for _, field := range githubFieldUpdates {
+			next[field] = jiraValues[field]
+		}
+		outcome.Fields = append(outcome.Fields, githubFieldUpdates...)
+	}
+
+	if len(r.Fields) > 0 && !maps.Equal(next, synced) {
+		op := Operation{Action: "record_synced", Number: issue.Number, Key: jiraIssue.Key}
+		if err := r.journaled(op, func() error { return r.Tracker.SetSyncedFields(ctx, jiraIssue.Key, next) }); err != nil {
+			logger.Error("Unable to record the synced values", "error", err)
+			return outcome, conflicts, fmt.Errorf("error recording the synced values: %w", err)
+		}
+	}
+
+	if outcome.To == "" && len(outcome.Fields) == 0 {
+		switch {
+		case outcome.Reason != "":
+		case len(conflicts) > 0:
+			outcome.Reason = "conflicting changes"
+		default:
+			outcome.Reason = "up to date"
+		}
+		logger.Debug("Skipping issue", "action", "skip", "reason", outcome.Reason)
+	}
+	return outcome, conflicts, nil
+}
+
+// transition moves the Jira issue to the target status, and records the
+// transition in the outcome. If no transition leads there, it sets the
+// reason of the outcome and reports false.
+func (r *Reconciler) transition(ctx context.Context, jiraIssue KnownIssue, targetStatus string, outcome *Outcome, logger *slog.Logger) (bool, error) {
+	logger = logger.With("action", "transition")
+	start := time.Now()
+
+	possibleTransitions, err := r.transitions.Get(ctx, jiraIssue)
+	if err != nil {
+		logger.Error("Unable to get transitions", "error", err, "duration", time.Since(start))
+		return false, fmt.Errorf("error getting transitions: %w", err)
+	}
+
+	var transitionID string
+	for _, v := range possibleTransitions {
+		if v.Name == targetStatus {
+			transitionID = v.ID
+			break
+		}
+	}
+
+	if transitionID == "" {
+		outcome.Reason = fmt.Sprintf("no %q transition available from %q", targetStatus, jiraIssue.Status.Name)
+		logger.Warn("Skipping issue", "action", "skip", "reason", outcome.Reason)
+		return false, nil
+	}
+
+	op := Operation{Action: "transition", Number: outcome.Number, Key: jiraIssue.Key, Detail: targetStatus}
+	if err := r.journaled(op, func() error { return r.Tracker.DoTransition(ctx, jiraIssue.Key, transitionID) }); err != nil {
+		logger.Error("Unable to transition issue", "to", targetStatus, "error", err, "duration", time.Since(start))
+		return false, fmt.Errorf("error transitioning to %s: %w", targetStatus, err)
+	}
+
+	logger.Info("Transitioned issue", "from", jiraIssue.Status.Name, "to", targetStatus, "duration", time.Since(start))
+	outcome.From, outcome.To = jiraIssue.Status.Name, targetStatus
+	return true, nil
+}
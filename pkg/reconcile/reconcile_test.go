@@ -0,0 +1,706 @@
+package reconcile_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shiftstack/bugwatcher/pkg/team"
+	"github.com/shiftstack/ghira/pkg/config"
+	"github.com/shiftstack/ghira/pkg/github"
+	"github.com/shiftstack/ghira/pkg/reconcile"
+	"github.com/shiftstack/ghira/pkg/reconcile/fake"
+)
+
+var (
+	statusToDo   = reconcile.Status{ID: "1", Name: "To Do"}
+	statusClosed = reconcile.Status{ID: "2", Name: "Closed"}
+	workflow     = []reconcile.Status{statusToDo, statusClosed}
+)
+
+func ghIssue(number int, status string) github.Issue {
+	return github.Issue{
+		Number: number,
+		Title:  "Issue",
+		Status: status,
+	}
+}
+
+func known(key string, status reconcile.Status) reconcile.KnownIssue {
+	return reconcile.KnownIssue{
+		Key:       key,
+		Project:   "OSASINFRA",
+		IssueType: "3",
+		Status:    status,
+	}
+}
+
+func TestReconcilerRun(t *testing.T) {
+	for _, tc := range [...]struct {
+		name             string
+		githubIssues     []github.Issue
+		known            map[int]reconcile.KnownIssue
+		workflow         []reconcile.Status
+		sourceErr        error
+		createErr        error
+		transitionsErr   error
+		wantErr          bool
+		wantFailures     []int
+		wantCreated      []int
+		wantTransitioned []fake.TransitionCall
+		wantTransitions  int
+	}{
+		{
+			name:         "new issues are created in ascending order",
+			githubIssues: []github.Issue{ghIssue(3, "open"), ghIssue(1, "closed"), ghIssue(2, "open")},
+			wantCreated:  []int{1, 2, 3},
+		},
+		{
+			name:             "closed on Github closes in Jira",
+			githubIssues:     []github.Issue{ghIssue(1, "closed")},
+			known:            map[int]reconcile.KnownIssue{1: known("OSASINFRA-1", statusToDo)},
+			workflow:         workflow,
+			wantTransitioned: []fake.TransitionCall{{Key: "OSASINFRA-1", To: "Closed"}},
+			wantTransitions:  1,
+		},
+		{
+			name:             "reopened on Github reopens in Jira",
+			githubIssues:     []github.Issue{ghIssue(1, "open")},
+			known:            map[int]reconcile.KnownIssue{1: known("OSASINFRA-1", statusClosed)},
+			workflow:         workflow,
+			wantTransitioned: []fake.TransitionCall{{Key: "OSASINFRA-1", To: "To Do"}},
+			wantTransitions:  1,
+		},
+		{
+			name:         "unchanged issues are skipped without fetching transitions",
+			githubIssues: []github.Issue{ghIssue(1, "open"), ghIssue(2, "closed")},
+			known: map[int]reconcile.KnownIssue{
+				1: known("OSASINFRA-1", statusToDo),
+				2: known("OSASINFRA-2", statusClosed),
+			},
+			workflow: workflow,
+		},
+		{
+			name:            "missing transition is skipped",
+			githubIssues:    []github.Issue{ghIssue(1, "closed")},
+			known:           map[int]reconcile.KnownIssue{1: known("OSASINFRA-1", statusToDo)},
+			workflow:        []reconcile.Status{statusToDo},
+			wantTransitions: 1,
+		},
+		{
+			name:         "transitions are cached per workflow state",
+			githubIssues: []github.Issue{ghIssue(1, "closed"), ghIssue(2, "closed"), ghIssue(3, "closed")},
+			known: map[int]reconcile.KnownIssue{
+				1: known("OSASINFRA-1", statusToDo),
+				2: known("OSASINFRA-2", statusToDo),
+				3: known("OSASINFRA-3", statusToDo),
+			},
+			workflow: workflow,
+			wantTransitioned: []fake.TransitionCall{
+				{Key: "OSASINFRA-1", To: "Closed"},
+				{Key: "OSASINFRA-2", To: "Closed"},
+				{Key: "OSASINFRA-3", To: "Closed"},
+			},
+			wantTransitions: 1,
+		},
+		{
+			name:         "creation errors don't stop the run",
+			githubIssues: []github.Issue{ghIssue(1, "closed"), ghIssue(2, "open"), ghIssue(3, "open")},
+			known:        map[int]reconcile.KnownIssue{1: known("OSASINFRA-1", statusToDo)},
+			workflow:     workflow,
+			createErr:    errors.New("boom"),
+			wantFailures: []int{2, 3},
+			wantTransitioned: []fake.TransitionCall{
+				{Key: "OSASINFRA-1", To: "Closed"},
+			},
+			wantTransitions: 1,
+		},
+		{
+			name:         "transition lookup errors are collected",
+			githubIssues: []github.Issue{ghIssue(1, "closed"), ghIssue(2, "open")},
+			known: map[int]reconcile.KnownIssue{
+				1: known("OSASINFRA-1", statusToDo),
+				2: known("OSASINFRA-2", statusToDo),
+			},
+			workflow:        workflow,
+			transitionsErr:  errors.New("boom"),
+			wantFailures:    []int{1},
+			wantTransitions: 1,
+		},
+		{
+			name:            "source errors abort the run before creating issues",
+			githubIssues:    []github.Issue{ghIssue(1, "closed"), ghIssue(2, "open")},
+			known:           map[int]reconcile.KnownIssue{1: known("OSASINFRA-1", statusToDo)},
+			workflow:        workflow,
+			sourceErr:       errors.New("boom"),
+			wantErr:         true,
+			wantTransitions: 1,
+			wantTransitioned: []fake.TransitionCall{
+				{Key: "OSASINFRA-1", To: "Closed"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tracker := &fake.Tracker{
+				Known:          tc.known,
+				Workflow:       tc.workflow,
+				CreateErr:      tc.createErr,
+				TransitionsErr: tc.transitionsErr,
+			}
+			r := &reconcile.Reconciler{
+				Source:      &fake.Source{GithubIssues: tc.githubIssues, Err: tc.sourceErr},
+				Tracker:     tracker,
+				Concurrency: 2,
+			}
+
+			result, err := r.Run(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error: %t, got %v", tc.wantErr, err)
+			}
+
+			var failures []int
+			for _, f := range result.Failures {
+				failures = append(failures, f.Number)
+			}
+			if !slices.Equal(failures, tc.wantFailures) {
+				t.Errorf("failures: expected %v, got %v", tc.wantFailures, failures)
+			}
+
+			var created []int
+			for _, issue := range tracker.Created {
+				created = append(created, issue.Number)
+			}
+			if !slices.Equal(created, tc.wantCreated) {
+				t.Errorf("created: expected %v, got %v", tc.wantCreated, created)
+			}
+
+			// Existing issues are processed concurrently, in no
+			// particular order.
+			slices.SortFunc(tracker.Transitioned, func(a, b fake.TransitionCall) int { return strings.Compare(a.Key, b.Key) })
+			if !slices.Equal(tracker.Transitioned, tc.wantTransitioned) {
+				t.Errorf("transitioned: expected %v, got %v", tc.wantTransitioned, tracker.Transitioned)
+			}
+
+			if tracker.TransitionsCalls != tc.wantTransitions {
+				t.Errorf("transitions calls: expected %d, got %d", tc.wantTransitions, tracker.TransitionsCalls)
+			}
+		})
+	}
+}
+
+func TestReconcilerRunResult(t *testing.T) {
+	author := ghIssue(1, "open")
+	author.Author.Handle = "alice"
+	stranger := ghIssue(2, "closed")
+	stranger.Author.Handle = "mallory"
+	stranger.Assignee.Handle = "eve"
+
+	tracker := &fake.Tracker{
+		Known: map[int]reconcile.KnownIssue{
+			1: known("OSASINFRA-1", statusToDo),
+			2: known("OSASINFRA-2", statusToDo),
+		},
+		Workflow: []reconcile.Status{statusToDo},
+	}
+	r := &reconcile.Reconciler{
+		Source:  &fake.Source{GithubIssues: []github.Issue{stranger, author}},
+		Tracker: tracker,
+		People:  []team.Person{{Github: "alice", JiraAccountID: "alice-id"}},
+	}
+
+	result, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []string{"eve", "mallory"}; !slices.Equal(result.UnmatchedUsers, want) {
+		t.Errorf("unmatched users: expected %v, got %v", want, result.UnmatchedUsers)
+	}
+
+	var reasons []string
+	for _, o := range result.Skipped {
+		reasons = append(reasons, o.Reason)
+	}
+	if want := []string{"up to date", `no "Closed" transition available from "To Do"`}; !slices.Equal(reasons, want) {
+		t.Errorf("skip reasons: expected %q, got %q", want, reasons)
+	}
+}
+
+func TestReconcilerSyncIssue(t *testing.T) {
+	tracker := &fake.Tracker{
+		Known:    map[int]reconcile.KnownIssue{1: known("OSASINFRA-1", statusToDo)},
+		Workflow: workflow,
+	}
+	r := &reconcile.Reconciler{
+		Source:  &fake.Source{GithubIssues: []github.Issue{ghIssue(1, "closed"), ghIssue(2, "open"), ghIssue(3, "closed")}},
+		Tracker: tracker,
+	}
+
+	for _, number := range []int{1, 2} {
+		result, err := r.SyncIssue(context.Background(), number)
+		if err != nil {
+			t.Fatalf("unexpected error syncing #%d: %v", number, err)
+		}
+		if result.Seen != 1 || len(result.Failures) != 0 {
+			t.Errorf("unexpected result syncing #%d: %+v", number, result)
+		}
+	}
+
+	if want := []fake.TransitionCall{{Key: "OSASINFRA-1", To: "Closed"}}; !slices.Equal(tracker.Transitioned, want) {
+		t.Errorf("transitioned: expected %v, got %v", want, tracker.Transitioned)
+	}
+	if len(tracker.Created) != 1 || tracker.Created[0].Number != 2 {
+		t.Errorf("created: expected #2 only, got %v", tracker.Created)
+	}
+
+	if _, err := r.SyncIssue(context.Background(), 4); err == nil {
+		t.Errorf("expected an error syncing a missing issue")
+	}
+}
+
+func TestReconcilerFields(t *testing.T) {
+	for _, tc := range [...]struct {
+		name         string
+		fields       map[string]config.Owner
+		github       string
+		jira         string
+		synced       reconcile.FieldValues
+		wantJira     bool
+		wantGithub   bool
+		wantConflict bool
+		wantSynced   string
+		wantNoSynced bool
+	}{
+		{
+			name:       "in sync",
+			fields:     map[string]config.Owner{"summary": config.OwnerGithub},
+			github:     "Crash",
+			jira:       "Crash",
+			wantSynced: "Crash",
+		},
+		{
+			name:       "owned by Github, changed on Github",
+			fields:     map[string]config.Owner{"summary": config.OwnerGithub},
+			github:     "Crash on boot",
+			jira:       "Crash",
+			synced:     reconcile.FieldValues{"summary": "Crash"},
+			wantJira:   true,
+			wantSynced: "Crash on boot",
+		},
+		{
+			name:       "owned by Github, changed in Jira",
+			fields:     map[string]config.Owner{"summary": config.OwnerGithub},
+			github:     "Crash",
+			jira:       "Crash on boot",
+			synced:     reconcile.FieldValues{"summary": "Crash"},
+			wantJira:   true,
+			wantSynced: "Crash",
+		},
+		{
+			name:       "owned by Jira, never synced",
+			fields:     map[string]config.Owner{"summary": config.OwnerJira},
+			github:     "Crash",
+			jira:       "Crash on boot",
+			wantGithub: true,
+			wantSynced: "Crash on boot",
+		},
+		{
+			name:       "last writer wins, changed in Jira",
+			fields:     map[string]config.Owner{"summary": config.OwnerLastWriter},
+			github:     "Crash",
+			jira:       "Crash on boot",
+			synced:     reconcile.FieldValues{"summary": "Crash"},
+			wantGithub: true,
+			wantSynced: "Crash on boot",
+		},
+		{
+			name:         "last writer wins, never synced",
+			fields:       map[string]config.Owner{"summary": config.OwnerLastWriter},
+			github:       "Crash",
+			jira:         "Crash on boot",
+			wantConflict: true,
+			wantNoSynced: true,
+		},
+		{
+			name:         "changed on both sides",
+			fields:       map[string]config.Owner{"summary": config.OwnerGithub},
+			github:       "Crash at startup",
+			jira:         "Crash on boot",
+			synced:       reconcile.FieldValues{"summary": "Crash"},
+			wantConflict: true,
+			wantSynced:   "Crash",
+		},
+		{
+			name:         "not synced",
+			github:       "Crash",
+			jira:         "Crash on boot",
+			wantNoSynced: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			issue := ghIssue(1, "open")
+			issue.Title = tc.github
+			jiraIssue := known("OSASINFRA-1", statusToDo)
+			jiraIssue.Fields = reconcile.FieldValues{"summary": tc.jira}
+
+			tracker := &fake.Tracker{
+				Known:    map[int]reconcile.KnownIssue{1: jiraIssue},
+				Workflow: workflow,
+			}
+			if tc.synced != nil {
+				tracker.Synced = map[string]reconcile.FieldValues{"OSASINFRA-1": tc.synced}
+			}
+			gh := &fake.Github{}
+			r := &reconcile.Reconciler{
+				Source:  &fake.Source{GithubIssues: []github.Issue{issue}},
+				Tracker: tracker,
+				Github:  gh,
+				Fields:  tc.fields,
+			}
+
+			result, err := r.Run(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(result.Failures) > 0 {
+				t.Fatalf("unexpected failures: %v", result.Failures)
+			}
+
+			if got := len(tracker.Updated) > 0; got != tc.wantJira {
+				t.Errorf("expected Jira update %t, got %v", tc.wantJira, tracker.Updated)
+			}
+			if got := len(gh.Updated) > 0; got != tc.wantGithub {
+				t.Errorf("expected Github update %t, got %v", tc.wantGithub, gh.Updated)
+			}
+			if got := len(result.Conflicts) > 0; got != tc.wantConflict {
+				t.Errorf("expected conflict %t, got %v", tc.wantConflict, result.Conflicts)
+			}
+			if updated := tc.wantJira || tc.wantGithub; updated != (len(result.Updated) == 1) {
+				t.Errorf("expected updated %t, got %v", updated, result.Updated)
+			}
+
+			synced, ok := tracker.Synced["OSASINFRA-1"]["summary"]
+			switch {
+			case tc.wantNoSynced && ok:
+				t.Errorf("expected no synced value, got %q", synced)
+			case !tc.wantNoSynced && synced != tc.wantSynced:
+				t.Errorf("expected synced value %q, got %q", tc.wantSynced, synced)
+			}
+		})
+	}
+}
+
+func TestReconcilerFixVersions(t *testing.T) {
+	for _, tc := range [...]struct {
+		name          string
+		milestone     string
+		fixVersions   string
+		wantMilestone string
+	}{
+		{
+			name:        "milestone among the fix versions",
+			milestone:   "4.18",
+			fixVersions: "4.17,4.18",
+		},
+		{
+			name:          "milestone not among the fix versions",
+			milestone:     "4.16",
+			fixVersions:   "4.17,4.18",
+			wantMilestone: "4.17",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			issue := ghIssue(1, "open")
+			issue.Milestone = &github.Milestone{Title: tc.milestone}
+			jiraIssue := known("OSASINFRA-1", statusToDo)
+			jiraIssue.Fields = reconcile.FieldValues{"fixVersion": tc.fixVersions}
+
+			gh := &fake.Github{}
+			r := &reconcile.Reconciler{
+				Source:  &fake.Source{GithubIssues: []github.Issue{issue}},
+				Tracker: &fake.Tracker{Known: map[int]reconcile.KnownIssue{1: jiraIssue}, Workflow: workflow},
+				Github:  gh,
+				Fields:  map[string]config.Owner{"fixVersion": config.OwnerJira},
+			}
+			if _, err := r.Run(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var milestone string
+			if len(gh.Updates) > 0 && gh.Updates[0].Milestone != nil {
+				milestone = *gh.Updates[0].Milestone
+			}
+			if milestone != tc.wantMilestone {
+				t.Errorf("expected the milestone to be set to %q, got %q (%v)", tc.wantMilestone, milestone, gh.Updated)
+			}
+		})
+	}
+}
+
+func TestReconcilerStatusOwnedByJira(t *testing.T) {
+	tracker := &fake.Tracker{
+		Known:    map[int]reconcile.KnownIssue{1: known("OSASINFRA-1", statusClosed)},
+		Workflow: workflow,
+	}
+	gh := &fake.Github{}
+	r := &reconcile.Reconciler{
+		Source:  &fake.Source{GithubIssues: []github.Issue{ghIssue(1, "open")}},
+		Tracker: tracker,
+		Github:  gh,
+		Fields:  map[string]config.Owner{"status": config.OwnerJira},
+	}
+
+	if _, err := r.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tracker.Transitioned) != 0 {
+		t.Errorf("expected no transition, got %v", tracker.Transitioned)
+	}
+	if len(gh.Updates) != 1 || gh.Updates[0].State == nil || *gh.Updates[0].State != "closed" {
+		t.Errorf("expected the Github issue to be closed, got %v", gh.Updated)
+	}
+}
+
+func TestReconcilerReverseStatus(t *testing.T) {
+	tracker := &fake.Tracker{
+		Known:    map[int]reconcile.KnownIssue{1: known("OSASINFRA-1", statusToDo)},
+		Workflow: workflow,
+	}
+	gh := &fake.Github{}
+	r := &reconcile.Reconciler{
+		Source:        &fake.Source{GithubIssues: []github.Issue{ghIssue(1, "closed")}},
+		Tracker:       tracker,
+		Github:        gh,
+		Fields:        map[string]config.Owner{"status": config.OwnerJira},
+		ReverseStatus: true,
+	}
+
+	result, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Failures) > 0 {
+		t.Fatalf("unexpected failures: %v", result.Failures)
+	}
+	if len(gh.Updates) != 0 {
+		t.Errorf("expected the Github issue to stay closed, got %v", gh.Updates)
+	}
+	if len(tracker.Transitioned) != 0 {
+		t.Errorf("expected no transition, got %v", tracker.Transitioned)
+	}
+}
+
+func TestReconcilerDuplicates(t *testing.T) {
+	canonical := known("OSASINFRA-1", statusToDo)
+	canonical.Duplicates = []string{"OSASINFRA-5", "OSASINFRA-9"}
+	tracker := &fake.Tracker{
+		Known:    map[int]reconcile.KnownIssue{1: canonical, 2: known("OSASINFRA-2", statusToDo)},
+		Workflow: workflow,
+	}
+	r := &reconcile.Reconciler{
+		Source:  &fake.Source{GithubIssues: []github.Issue{ghIssue(1, "closed"), ghIssue(2, "open")}},
+		Tracker: tracker,
+	}
+
+	result, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Duplicates) != 1 || result.Duplicates[0].Number != 1 || result.Duplicates[0].Key != "OSASINFRA-1" || !slices.Equal(result.Duplicates[0].Duplicates, canonical.Duplicates) {
+		t.Errorf("expected #1 to be reported with its duplicates, got %+v", result.Duplicates)
+	}
+	if want := []fake.TransitionCall{{Key: "OSASINFRA-1", To: "Closed"}}; !slices.Equal(tracker.Transitioned, want) {
+		t.Errorf("expected the canonical issue to be synced, got %v", tracker.Transitioned)
+	}
+}
+
+func TestReconcilerOrphans(t *testing.T) {
+	moved := github.Issue{Number: 7, Title: "Issue", URL: "https://github.com/o/other/issues/7"}
+	newTracker := func() *fake.Tracker {
+		return &fake.Tracker{
+			Known: map[int]reconcile.KnownIssue{
+				1: known("OSASINFRA-1", statusToDo),
+				2: known("OSASINFRA-2", statusToDo),
+				3: known("OSASINFRA-3", statusToDo),
+				4: known("OSASINFRA-4", statusToDo),
+			},
+			Workflow: workflow,
+		}
+	}
+	newGithub := func() *fake.Github {
+		return &fake.Github{Locations: map[int]github.Location{
+			2: {Moved: &moved},
+			3: {Gone: true},
+		}}
+	}
+	source := &fake.Source{GithubIssues: []github.Issue{ghIssue(1, "open")}}
+
+	t.Run("reported", func(t *testing.T) {
+		tracker := newTracker()
+		gh := newGithub()
+		r := &reconcile.Reconciler{Source: source, Tracker: tracker, Locator: gh}
+		result, err := r.Run(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []reconcile.Orphan{
+			{Number: 2, Key: "OSASINFRA-2", Reason: reconcile.OrphanTransferred, URL: moved.URL},
+			{Number: 3, Key: "OSASINFRA-3", Reason: reconcile.OrphanDeleted},
+		}
+		if !slices.Equal(result.Orphans, want) {
+			t.Errorf("expected orphans %+v, got %+v", want, result.Orphans)
+		}
+		if want := []fake.RelinkCall{{Key: "OSASINFRA-2", URL: moved.URL}}; !slices.Equal(tracker.Relinked, want) {
+			t.Errorf("expected the transferred issue to be relinked, got %v", tracker.Relinked)
+		}
+		if len(tracker.MarkedOrphans) != 0 || len(tracker.Transitioned) != 0 {
+			t.Errorf("expected no orphan action without configuration, got %v, %v", tracker.MarkedOrphans, tracker.Transitioned)
+		}
+
+		// The deletion is final: it is reported again without looking
+		// the issue up.
+		gh.Located = nil
+		result, err = r.Run(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !slices.ContainsFunc(result.Orphans, func(o reconcile.Orphan) bool { return o.Number == 3 }) || slices.Contains(gh.Located, 3) {
+			t.Errorf("expected #3 to be reported without a lookup, got %+v, located %v", result.Orphans, gh.Located)
+		}
+	})
+
+	t.Run("handled once", func(t *testing.T) {
+		tracker := newTracker()
+		gh := newGithub()
+		r := &reconcile.Reconciler{
+			Source:  source,
+			Tracker: tracker,
+			Locator: gh,
+			Orphans: &config.Orphans{Comment: "Deleted", Label: "gh-deleted", Close: true},
+		}
+		if _, err := r.Run(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := []fake.OrphanCall{{Key: "OSASINFRA-3", Comment: "Deleted", Label: "gh-deleted"}}; !slices.Equal(tracker.MarkedOrphans, want) {
+			t.Errorf("expected the deleted issue to be marked, got %v", tracker.MarkedOrphans)
+		}
+		if want := []fake.TransitionCall{{Key: "OSASINFRA-3", To: "Closed"}}; !slices.Equal(tracker.Transitioned, want) {
+			t.Errorf("expected the deleted issue to be closed, got %v", tracker.Transitioned)
+		}
+
+		result, err := r.Run(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(tracker.MarkedOrphans) != 1 || slices.ContainsFunc(result.Orphans, func(o reconcile.Orphan) bool { return o.Number == 3 }) {
+			t.Errorf("expected the orphan to be handled once, got %v and %+v", tracker.MarkedOrphans, result.Orphans)
+		}
+		if want := []int{2, 3, 4, 2, 4}; !slices.Equal(gh.Located, want) {
+			t.Errorf("expected the handled orphan not to be looked up again, got %v", gh.Located)
+		}
+	})
+
+	t.Run("labelled", func(t *testing.T) {
+		tracker := newTracker()
+		labelled := tracker.Known[3]
+		labelled.Fields = reconcile.FieldValues{"labels": "gh-deleted,triaged"}
+		tracker.Known[3] = labelled
+		gh := newGithub()
+		r := &reconcile.Reconciler{
+			Source:  source,
+			Tracker: tracker,
+			Locator: gh,
+			Orphans: &config.Orphans{Label: "gh-deleted"},
+		}
+		if _, err := r.Run(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if slices.Contains(gh.Located, 3) || len(tracker.MarkedOrphans) != 0 {
+			t.Errorf("expected the labelled orphan to be skipped, got located %v, marked %v", gh.Located, tracker.MarkedOrphans)
+		}
+	})
+}
+
+func TestReconcilerCreatedConcurrently(t *testing.T) {
+	tracker := &fake.Tracker{
+		Unlisted: map[int]reconcile.KnownIssue{1: known("OSASINFRA-1", statusToDo)},
+		Workflow: workflow,
+	}
+	r := &reconcile.Reconciler{
+		Source:  &fake.Source{GithubIssues: []github.Issue{ghIssue(1, "closed")}},
+		Tracker: tracker,
+	}
+
+	result, err := r.Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tracker.Created) != 0 || len(result.Created) != 0 {
+		t.Errorf("expected no creation, got %v", tracker.Created)
+	}
+	if want := []fake.TransitionCall{{Key: "OSASINFRA-1", To: "Closed"}}; !slices.Equal(tracker.Transitioned, want) {
+		t.Errorf("expected the existing issue to be synced, got %v", tracker.Transitioned)
+	}
+}
+
+func TestReconcilerRunCancelled(t *testing.T) {
+	tracker := &fake.Tracker{
+		Known:    map[int]reconcile.KnownIssue{1: known("OSASINFRA-1", statusToDo)},
+		Workflow: workflow,
+	}
+	r := &reconcile.Reconciler{
+		Source:  &fake.Source{GithubIssues: []github.Issue{ghIssue(1, "closed"), ghIssue(2, "open")}},
+		Tracker: tracker,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := r.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(tracker.Created) != 0 || len(tracker.Transitioned) != 0 {
+		t.Errorf("expected no change after cancellation, got created %v, transitioned %v", tracker.Created, tracker.Transitioned)
+	}
+}
+
+func TestResolveNames(t *testing.T) {
+	people := []team.Person{
+		{Github: "alice", JiraAccountID: "alice-id"},
+		{Github: "bob", JiraAccountID: "bob-id"},
+	}
+
+	in := make(chan github.Issue, 2)
+	{
+		var issue github.Issue
+		issue.Author.Handle = "alice"
+		issue.Assignee.Handle = "bob"
+		in <- issue
+	}
+	{
+		var issue github.Issue
+		issue.Author.Handle = "mallory"
+		in <- issue
+	}
+	close(in)
+
+	var out []github.Issue
+	for issue := range reconcile.ResolveNames(in, people) {
+		out = append(out, issue)
+	}
+
+	if len(out) != 2 {
+		t.Fatalf("expected 2 issues, got %d", len(out))
+	}
+	if got := out[0].Author.JiraAccountID; got != "alice-id" {
+		t.Errorf("expected author alice-id, got %q", got)
+	}
+	if got := out[0].Assignee.JiraAccountID; got != "bob-id" {
+		t.Errorf("expected assignee bob-id, got %q", got)
+	}
+	if got := out[1].Author.JiraAccountID; got != "" {
+		t.Errorf("expected no account for a non-team member, got %q", got)
+	}
+}
@@ -0,0 +1,57 @@
+package reconcile
+
+import (
+	"context"
+	"sync"
+)
+
+// transitionKey identifies a workflow state. All the issues of the same
+// type, in the same project and status share the same outgoing transitions.
+type transitionKey struct {
+	Project   string
+	IssueType string
+	Status    string
+}
+
+// transitionCache memoizes the transitions available from each workflow
+// state, so that they are fetched once per state rather than once per issue.
+type transitionCache struct {
+	tracker Tracker
+
+	mu          sync.Mutex
+	transitions map[transitionKey][]Transition
+}
+
+func newTransitionCache(tracker Tracker) *transitionCache {
+	return &transitionCache{
+		tracker:     tracker,
+		transitions: make(map[transitionKey][]Transition),
+	}
+}
+
+// Get returns the transitions available to the given issue, fetching them
+// from the tracker on cache miss. Errors are not cached.
+func (c *transitionCache) Get(ctx context.Context, issue KnownIssue) ([]Transition, error) {
+	key := transitionKey{
+		Project:   issue.Project,
+		IssueType: issue.IssueType,
+		Status:    issue.Status.ID,
+	}
+
+	c.mu.Lock()
+	transitions, ok := c.transitions[key]
+	c.mu.Unlock()
+	if ok {
+		return transitions, nil
+	}
+
+	transitions, err := c.tracker.Transitions(ctx, issue)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.transitions[key] = transitions
+	c.mu.Unlock()
+	return transitions, nil
+}
@@ -0,0 +1,303 @@
+// Package report renders the outcome of a run as JSON, for machines, and as
+// Markdown, for humans.
+package report
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/reconcile"
+)
+
+// Issue is a Github issue in the report.
+type Issue struct {
+	Number int      `json:"number"`
+	Title  string   `json:"title,omitempty"`
+	URL    string   `json:"url,omitempty"`
+	Key    string   `json:"jira_key,omitempty"`
+	From   string   `json:"from,omitempty"`
+	To     string   `json:"to,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+	Reason string   `json:"reason,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Conflict is a field that changed on both Github and Jira since it was last
+// synced.
+type Conflict struct {
+	Number int    `json:"number"`
+	Key    string `json:"jira_key"`
+	Field  string `json:"field"`
+	Github string `json:"github"`
+	Jira   string `json:"jira"`
+	Synced string `json:"synced"`
+}
+
+// Duplicate is a Github issue mirrored by several Jira issues. Key is the
+// one that is synced.
+type Duplicate struct {
+	Number     int      `json:"number"`
+	Key        string   `json:"jira_key"`
+	Duplicates []string `json:"duplicates"`
+}
+
+// Orphan is a Jira issue whose Github issue was transferred or deleted.
+type Orphan struct {
+	Number int    `json:"number"`
+	Key    string `json:"jira_key"`
+	Reason string `json:"reason"`
+	URL    string `json:"url,omitempty"`
+}
+
+// Counts sums up the outcome of a run.
+type Counts struct {
+	Seen           int `json:"seen"`
+	Created        int `json:"created"`
+	Transitioned   int `json:"transitioned"`
+	Updated        int `json:"updated"`
+	Skipped        int `json:"skipped"`
+	Failed         int `json:"failed"`
+	Conflicts      int `json:"conflicts"`
+	Duplicates     int `json:"duplicates"`
+	Orphans        int `json:"orphans"`
+	UnmatchedUsers int `json:"unmatched_users"`
+}
+
+// Report is the outcome of a run.
+type Report struct {
+	Repository string    `json:"repository"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+
+	// Error is set when the run could not complete. The lists then only
+	// cover the issues processed until then.
+	Error string `json:"error,omitempty"`
+
+	Counts         Counts      `json:"counts"`
+	Created        []Issue     `json:"created"`
+	Transitioned   []Issue     `json:"transitioned"`
+	Updated        []Issue     `json:"updated"`
+	Skipped        []Issue     `json:"skipped"`
+	Failed         []Issue     `json:"failed"`
+	Conflicts      []Conflict  `json:"conflicts"`
+	Duplicates     []Duplicate `json:"duplicates"`
+	Orphans        []Orphan    `json:"orphans"`
+	UnmatchedUsers []string    `json:"unmatched_users"`
+}
+
+func fromOutcomes(outcomes []reconcile.Outcome) []Issue {
+	issues := make([]Issue, 0, len(outcomes))
+	for _, o := range outcomes {
+		issues = append(issues, Issue{
+			Number: o.Number,
+			Title:  o.Title,
+			URL:    o.URL,
+			Key:    o.Key,
+			From:   o.From,
+			To:     o.To,
+			Fields: o.Fields,
+			Reason: o.Reason,
+		})
+	}
+	return issues
+}
+
+// New builds the report of a run. runErr is the error returned by the run,
+// if any.
+func New(repository string, startedAt, finishedAt time.Time, result reconcile.Result, runErr error) Report {
+	r := Report{
+		Repository:     repository,
+		StartedAt:      startedAt.UTC(),
+		FinishedAt:     finishedAt.UTC(),
+		Created:        fromOutcomes(result.Created),
+		Transitioned:   fromOutcomes(result.Transitioned),
+		Updated:        fromOutcomes(result.Updated),
+		Skipped:        fromOutcomes(result.Skipped),
+		Failed:         make([]Issue, 0, len(result.Failures)),
+		Conflicts:      make([]Conflict, 0, len(result.Conflicts)),
+		Duplicates:     make([]Duplicate, 0, len(result.Duplicates)),
+		Orphans:        make([]Orphan, 0, len(result.Orphans)),
+		UnmatchedUsers: append([]string{}, result.UnmatchedUsers...),
+	}
+	if runErr != nil {
+		r.Error = runErr.Error()
+	}
+	for _, f := range result.Failures {
+		r.Failed = append(r.Failed, Issue{
+			Number: f.Number,
+			Key:    f.Key,
+			Error:  f.Err.Error(),
+		})
+	}
+	for _, c := range result.Conflicts {
+		r.Conflicts = append(r.Conflicts, Conflict(c))
+	}
+	for _, d := range result.Duplicates {
+		r.Duplicates = append(r.Duplicates, Duplicate(d))
+	}
+	for _, o := range result.Orphans {
+		r.Orphans = append(r.Orphans, Orphan(o))
+	}
+	r.Counts = Counts{
+		Seen:           result.Seen,
+		Created:        len(r.Created),
+		Transitioned:   len(r.Transitioned),
+		Updated:        len(r.Updated),
+		Skipped:        len(r.Skipped),
+		Failed:         len(r.Failed),
+		Conflicts:      len(r.Conflicts),
+		Duplicates:     len(r.Duplicates),
+		Orphans:        len(r.Orphans),
+		UnmatchedUsers: len(r.UnmatchedUsers),
+	}
+	return r
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteMarkdown writes the report as Github-flavoured Markdown, suitable for
+// a CI job summary. Skipped issues are grouped by reason and collapsed.
+func (r Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "## ghira sync of %s\n\n", r.Repository)
+	if r.Error != "" {
+		fmt.Fprintf(&b, "> [!CAUTION]\n> The run did not complete: %s\n\n", escape(r.Error))
+	}
+	fmt.Fprintf(&b, "Run from %s to %s (%s).\n\n", r.StartedAt.Format(time.RFC3339), r.FinishedAt.Format(time.RFC3339), r.FinishedAt.Sub(r.StartedAt).Round(time.Second))
+
+	b.WriteString("| Seen | Created | Transitioned | Updated | Skipped | Failed | Conflicts | Duplicates | Orphans | Unmatched users |\n")
+	b.WriteString("| ---: | ---: | ---: | ---: | ---: | ---: | ---: | ---: | ---: | ---: |\n")
+	fmt.Fprintf(&b, "| %d | %d | %d | %d | %d | %d | %d | %d | %d | %d |\n", r.Counts.Seen, r.Counts.Created, r.Counts.Transitioned, r.Counts.Updated, r.Counts.Skipped, r.Counts.Failed, r.Counts.Conflicts, r.Counts.Duplicates, r.Counts.Orphans, r.Counts.UnmatchedUsers)
+
+	if len(r.Failed) > 0 {
+		b.WriteString("\n### Failed\n\n")
+		for _, i := range r.Failed {
+			fmt.Fprintf(&b, "* %s: %s\n", issueRef(i), escape(i.Error))
+		}
+	}
+
+	if len(r.Conflicts) > 0 {
+		b.WriteString("\n### Conflicts\n\n")
+		b.WriteString("| Issue | Field | Github | Jira | Last synced |\n")
+		b.WriteString("| --- | --- | --- | --- | --- |\n")
+		for _, c := range r.Conflicts {
+			fmt.Fprintf(&b, "| #%d (%s) | %s | %s | %s | %s |\n", c.Number, c.Key, c.Field, escape(c.Github), escape(c.Jira), escape(c.Synced))
+		}
+	}
+
+	if len(r.Duplicates) > 0 {
+		b.WriteString("\n### Duplicates\n\n")
+		b.WriteString("Only the first Jira issue of each line is synced. Run `ghira dedupe` to close the others.\n\n")
+		for _, d := range r.Duplicates {
+			fmt.Fprintf(&b, "* #%d: %s, duplicated by %s\n", d.Number, d.Key, strings.Join(d.Duplicates, ", "))
+		}
+	}
+
+	if len(r.Orphans) > 0 {
+		b.WriteString("\n### Orphans\n\n")
+		for _, o := range r.Orphans {
+			if o.URL != "" {
+				fmt.Fprintf(&b, "* #%d (%s): %s to %s\n", o.Number, o.Key, o.Reason, o.URL)
+			} else {
+				fmt.Fprintf(&b, "* #%d (%s): %s\n", o.Number, o.Key, o.Reason)
+			}
+		}
+	}
+
+	if len(r.Created) > 0 {
+		b.WriteString("\n### Created\n\n")
+		for _, i := range r.Created {
+			fmt.Fprintf(&b, "* %s\n", issueRef(i))
+		}
+	}
+
+	if len(r.Transitioned) > 0 {
+		b.WriteString("\n### Transitioned\n\n")
+		for _, i := range r.Transitioned {
+			fmt.Fprintf(&b, "* %s: %s → %s\n", issueRef(i), escape(i.From), escape(i.To))
+		}
+	}
+
+	if len(r.Updated) > 0 {
+		b.WriteString("\n### Updated\n\n")
+		for _, i := range r.Updated {
+			fmt.Fprintf(&b, "* %s: %s\n", issueRef(i), strings.Join(i.Fields, ", "))
+		}
+	}
+
+	if len(r.Skipped) > 0 {
+		b.WriteString("\n### Skipped\n")
+		byReason := make(map[string][]Issue)
+		for _, i := range r.Skipped {
+			byReason[i.Reason] = append(byReason[i.Reason], i)
+		}
+		// The most frequent reasons first
+		reasons := slices.SortedFunc(maps.Keys(byReason), func(a, b string) int {
+			return cmp.Or(cmp.Compare(len(byReason[b]), len(byReason[a])), strings.Compare(a, b))
+		})
+		for _, reason := range reasons {
+			issues := byReason[reason]
+			fmt.Fprintf(&b, "\n<details><summary>%s (%d)</summary>\n\n", escape(reason), len(issues))
+			for _, i := range issues {
+				fmt.Fprintf(&b, "* %s\n", issueRef(i))
+			}
+			b.WriteString("\n</details>\n")
+		}
+	}
+
+	if len(r.UnmatchedUsers) > 0 {
+		b.WriteString("\n### Github users not in the team\n\n")
+		for _, u := range r.UnmatchedUsers {
+			fmt.Fprintf(&b, "* @%s\n", u)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func issueRef(i Issue) string {
+	ref := "#" + strconv.Itoa(i.Number)
+	if i.URL != "" {
+		ref = "[" + ref + "](" + i.URL + ")"
+	}
+	if i.Key != "" {
+		ref += " (" + i.Key + ")"
+	}
+	if i.Title != "" {
+		ref += " " + escape(i.Title)
+	}
+	return ref
+}
+
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"*", "\\*",
+	"_", "\\_",
+	"`", "\\`",
+	"[", "\\[",
+	"]", "\\]",
+	"<", "&lt;",
+	">", "&gt;",
+	"|", "\\|",
+	"\n", " ",
+)
+
+// escape prevents text from Github or Jira from being interpreted as
+// Markdown or HTML.
+func escape(s string) string {
+	return markdownEscaper.Replace(s)
+}
@@ -0,0 +1,85 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/reconcile"
+	"github.com/shiftstack/ghira/pkg/report"
+)
+
+func testReport() report.Report {
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	result := reconcile.Result{
+		Seen:         4,
+		Created:      []reconcile.Outcome{{Number: 1, Title: "New *thing*", URL: "https://github.com/o/r/issues/1", Key: "OSASINFRA-10"}},
+		Transitioned: []reconcile.Outcome{{Number: 2, Key: "OSASINFRA-2", From: "To Do", To: "Closed"}},
+		Skipped: []reconcile.Outcome{
+			{Number: 3, Key: "OSASINFRA-3", Reason: "up to date"},
+		},
+		Failures:       []reconcile.Failure{{Number: 4, Key: "OSASINFRA-4", Err: errors.New("boom")}},
+		Conflicts:      []reconcile.Conflict{{Number: 3, Key: "OSASINFRA-3", Field: "summary", Github: "Crash", Jira: "Crash on boot", Synced: "Crashes"}},
+		Duplicates:     []reconcile.Duplicate{{Number: 2, Key: "OSASINFRA-2", Duplicates: []string{"OSASINFRA-7"}}},
+		Orphans:        []reconcile.Orphan{{Number: 5, Key: "OSASINFRA-5", Reason: reconcile.OrphanTransferred, URL: "https://github.com/o/other/issues/1"}},
+		UnmatchedUsers: []string{"mallory"},
+	}
+	return report.New("o/r", started, started.Add(90*time.Second), result, nil)
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got report.Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	want := report.Counts{Seen: 4, Created: 1, Transitioned: 1, Skipped: 1, Failed: 1, Conflicts: 1, Duplicates: 1, Orphans: 1, UnmatchedUsers: 1}
+	if got.Counts != want {
+		t.Errorf("expected counts %+v, got %+v", want, got.Counts)
+	}
+	if got.Failed[0].Error != "boom" {
+		t.Errorf("expected the failure error to be reported, got %q", got.Failed[0].Error)
+	}
+	if got.Conflicts[0].Field != "summary" {
+		t.Errorf("expected the conflicting field to be reported, got %q", got.Conflicts[0].Field)
+	}
+	if got.Updated == nil {
+		t.Errorf("expected empty lists to be rendered as [], not null")
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().WriteMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	md := buf.String()
+
+	for _, want := range []string{
+		"| 4 | 1 | 1 | 0 | 1 | 1 | 1 | 1 | 1 | 1 |",
+		"* #5 (OSASINFRA-5): transferred to https://github.com/o/other/issues/1",
+		"* #2: OSASINFRA-2, duplicated by OSASINFRA-7",
+		"| #3 (OSASINFRA-3) | summary | Crash | Crash on boot | Crashes |",
+		"* [#1](https://github.com/o/r/issues/1) (OSASINFRA-10) New \\*thing\\*",
+		"* #2 (OSASINFRA-2): To Do → Closed",
+		"<details><summary>up to date (1)</summary>",
+		"* #4 (OSASINFRA-4): boom",
+		"* @mallory",
+		"(1m30s)",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected the Markdown report to contain %q, got:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "### Updated") {
+		t.Errorf("expected empty sections to be omitted, got:\n%s", md)
+	}
+}
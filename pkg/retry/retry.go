@@ -0,0 +1,355 @@
+// Package retry implements an http.RoundTripper that waits out rate limits
+// and retries transient failures with jittered exponential backoff.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBaseDelay   = time.Second
+	defaultMaxDelay    = time.Minute
+	defaultMaxWait     = 15 * time.Minute
+)
+
+// Transport retries requests that failed with a network error, a 5xx status
+// code or a rate-limit response.
+//
+// Rate-limit responses (429, or 403 with an exhausted rate limit) are retried
+// for every method, since the server has not processed the request. Network
+// errors and 5xx responses are only retried for idempotent requests: GET,
+// HEAD, OPTIONS, TRACE, PUT, DELETE, and requests carrying an
+// Idempotency-Key or X-Idempotency-Key header, as for net/http.
+//
+// The wait before a retry honours Retry-After, then X-RateLimit-Reset when
+// X-RateLimit-Remaining is zero, and falls back to jittered exponential
+// backoff. When a response reports that the rate limit is exhausted, the
+// following requests are held until the limit resets. Github has a rate limit
+// per resource, reported by X-RateLimit-Resource: only the requests to the
+// exhausted resource are held.
+//
+// When the attempts are exhausted on a status code, the last response is
+// returned to the caller as-is; when they are exhausted on a network error,
+// an *Error is returned.
+type Transport struct {
+	// Name identifies the remote service in log messages.
+	Name string
+
+	// Transport is the underlying RoundTripper. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// MaxAttempts is the maximum number of times a request is sent.
+	// Defaults to 5.
+	MaxAttempts int
+
+	// BaseDelay is the backoff before the first retry; it doubles with
+	// every attempt. Defaults to one second.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the exponential backoff. Defaults to one minute.
+	MaxDelay time.Duration
+
+	// MaxWait is the longest wait that is honoured when the server
+	// requests one. Beyond this, the request fails instead. Defaults to
+	// 15 minutes.
+	MaxWait time.Duration
+
+	// Timeout bounds each attempt, including reading the response body.
+	// Zero means no timeout.
+	Timeout time.Duration
+
+	mu      sync.Mutex
+	resetAt map[string]time.Time
+}
+
+// Error is returned when a request could not be completed within the
+// allowed attempts.
+type Error struct {
+	Method   string
+	URL      string
+	Attempts int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: giving up after %d attempts: %v", e.Method, e.URL, e.Attempts, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (t *Transport) maxAttempts() int {
+	if t.MaxAttempts > 0 {
+		return t.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+func (t *Transport) maxWait() time.Duration {
+	if t.MaxWait > 0 {
+		return t.MaxWait
+	}
+	return defaultMaxWait
+}
+
+func (t *Transport) name() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return "server"
+}
+
+// backoff returns the jittered exponential delay before the given retry
+// (starting at 1).
+func (t *Transport) backoff(retry int) time.Duration {
+	base, max := t.BaseDelay, t.MaxDelay
+	if base <= 0 {
+		base = defaultBaseDelay
+	}
+	if max <= 0 {
+		max = defaultMaxDelay
+	}
+
+	d := base << (retry - 1)
+	if d <= 0 || d > max {
+		d = max
+	}
+	// Equal jitter: between half and the full delay.
+	return d/2 + rand.N(d/2+1)
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	canRewind := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		if err := t.waitForReset(req); err != nil {
+			return nil, err
+		}
+
+		r := req
+		if attempt > 1 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		cancel := context.CancelFunc(func() {})
+		if t.Timeout > 0 {
+			var ctx context.Context
+			ctx, cancel = context.WithTimeout(req.Context(), t.Timeout)
+			r = r.WithContext(ctx)
+		}
+
+		res, err := t.transport().RoundTrip(r)
+		lastAttempt := attempt >= t.maxAttempts() || !canRewind
+
+		if err != nil {
+			cancel()
+			if !isIdempotent(req) || req.Context().Err() != nil {
+				return nil, err
+			}
+			if lastAttempt {
+				return nil, &Error{Method: req.Method, URL: req.URL.Redacted(), Attempts: attempt, Err: err}
+			}
+			wait := t.backoff(attempt)
+			slog.Warn("Request failed, retrying", "service", t.name(), "error", err, "wait", wait.Round(time.Millisecond), "attempt", attempt+1, "max_attempts", t.maxAttempts())
+			if err := sleep(req, wait); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		t.recordRateLimit(res)
+
+		var retryable bool
+		switch {
+		case isRateLimited(res):
+			retryable = true
+		case res.StatusCode >= 500 && res.StatusCode != http.StatusNotImplemented:
+			retryable = isIdempotent(req)
+		}
+		if !retryable || lastAttempt {
+			res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+			return res, nil
+		}
+
+		wait, ok := serverWait(res)
+		if !ok {
+			wait = t.backoff(attempt)
+		}
+		if wait > t.maxWait() {
+			slog.Warn("Requested wait is too long, not retrying", "service", t.name(), "wait", wait.Round(time.Second), "max_wait", t.maxWait())
+			res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+			return res, nil
+		}
+
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		cancel()
+
+		if isRateLimited(res) {
+			slog.Warn("Throttled, waiting", "service", t.name(), "status", res.StatusCode, "wait", wait.Round(time.Millisecond), "attempt", attempt+1, "max_attempts", t.maxAttempts())
+		} else {
+			slog.Warn("Server error, retrying", "service", t.name(), "status", res.StatusCode, "wait", wait.Round(time.Millisecond), "attempt", attempt+1, "max_attempts", t.maxAttempts())
+		}
+		if err := sleep(req, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// cancelOnClose releases the context of an attempt once its response body is
+// closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// recordRateLimit holds subsequent requests to the same resource until the
+// reset time when the response reports an exhausted rate limit.
+func (t *Transport) recordRateLimit(res *http.Response) {
+	if res.Header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+	reset, ok := rateLimitReset(res)
+	if !ok {
+		return
+	}
+	resource := res.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = defaultResource
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.resetAt == nil {
+		t.resetAt = make(map[string]time.Time)
+	}
+	if reset.After(t.resetAt[resource]) {
+		t.resetAt[resource] = reset
+	}
+}
+
+func (t *Transport) waitForReset(req *http.Request) error {
+	resource := requestResource(req)
+	t.mu.Lock()
+	resetAt := t.resetAt[resource]
+	t.mu.Unlock()
+
+	wait := time.Until(resetAt)
+	if wait <= 0 {
+		return nil
+	}
+	if wait > t.maxWait() {
+		return fmt.Errorf("%s %s rate limit exhausted until %s", t.name(), resource, resetAt.Format(time.RFC3339))
+	}
+	slog.Warn("Rate limit exhausted, waiting", "service", t.name(), "resource", resource, "wait", wait.Round(time.Second))
+	return sleep(req, wait)
+}
+
+// defaultResource is the rate-limit resource of the responses that don't
+// report one, and of the requests to the other Github endpoints.
+const defaultResource = "core"
+
+// requestResource returns the Github rate-limit resource that a request
+// counts against.
+func requestResource(req *http.Request) string {
+	switch path := req.URL.Path; {
+	case path == "/graphql":
+		return "graphql"
+	case strings.HasPrefix(path, "/search/code"):
+		return "code_search"
+	case strings.HasPrefix(path, "/search/"):
+		return "search"
+	}
+	return defaultResource
+}
+
+func sleep(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+// isRateLimited reports whether the server rejected the request because of a
+// primary or secondary rate limit.
+func isRateLimited(res *http.Response) bool {
+	switch res.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return res.Header.Get("Retry-After") != "" || res.Header.Get("X-RateLimit-Remaining") == "0"
+	}
+	return false
+}
+
+// serverWait returns the wait requested by the server, if any.
+func serverWait(res *http.Response) (time.Duration, bool) {
+	if retryAfter := res.Header.Get("Retry-After"); retryAfter != "" {
+		if n, err := strconv.Atoi(retryAfter); err == nil && n >= 0 {
+			return time.Duration(n) * time.Second, true
+		}
+		if t, err := http.ParseTime(retryAfter); err == nil {
+			return max(time.Until(t), 0), true
+		}
+	}
+
+	if res.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, ok := rateLimitReset(res); ok {
+			// Allow for clock skew.
+			return max(time.Until(reset), 0) + time.Second, true
+		}
+	}
+
+	return 0, false
+}
+
+// rateLimitReset parses X-RateLimit-Reset, in epoch seconds.
+func rateLimitReset(res *http.Response) (time.Time, bool) {
+	n, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(n, 0), true
+}
@@ -0,0 +1,270 @@
+package retry_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/retry"
+)
+
+// script answers the requests with the given handlers in turn, repeating the
+// last one, and records the requests.
+type script struct {
+	mu       sync.Mutex
+	handlers []http.HandlerFunc
+	bodies   []string
+}
+
+func (s *script) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	body, _ := io.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(body))
+	handler := s.handlers[min(len(s.bodies), len(s.handlers))-1]
+	s.mu.Unlock()
+	handler(w, r)
+}
+
+func (s *script) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+func status(code int, header ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(header); i += 2 {
+			w.Header().Set(header[i], header[i+1])
+		}
+		w.WriteHeader(code)
+	}
+}
+
+func newClient(t *retry.Transport) *http.Client {
+	if t.BaseDelay == 0 {
+		t.BaseDelay = time.Millisecond
+	}
+	return &http.Client{Transport: t}
+}
+
+func do(t *testing.T, client *http.Client, method, url, body string, header ...string) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = bytes.NewReader([]byte(body))
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res
+}
+
+func TestTransportServerWait(t *testing.T) {
+	for _, tc := range [...]struct {
+		name         string
+		first        http.HandlerFunc
+		wantStatus   int
+		wantRequests int
+	}{
+		{
+			name:         "Retry-After in seconds",
+			first:        status(http.StatusTooManyRequests, "Retry-After", "0"),
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		{
+			name:         "Retry-After as a date",
+			first:        status(http.StatusServiceUnavailable, "Retry-After", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)),
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		{
+			name:         "exhausted rate limit",
+			first:        status(http.StatusForbidden, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", strconv.FormatInt(time.Now().Unix(), 10)),
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+		},
+		{
+			name:         "Retry-After beyond the maximum wait",
+			first:        status(http.StatusTooManyRequests, "Retry-After", "3600"),
+			wantStatus:   http.StatusTooManyRequests,
+			wantRequests: 1,
+		},
+		{
+			name:         "exhausted rate limit beyond the maximum wait",
+			first:        status(http.StatusForbidden, "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)),
+			wantStatus:   http.StatusForbidden,
+			wantRequests: 1,
+		},
+		{
+			name:         "forbidden",
+			first:        status(http.StatusForbidden),
+			wantStatus:   http.StatusForbidden,
+			wantRequests: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &script{handlers: []http.HandlerFunc{tc.first, status(http.StatusOK)}}
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			client := newClient(&retry.Transport{MaxWait: time.Minute})
+			if res := do(t, client, http.MethodGet, server.URL, ""); res.StatusCode != tc.wantStatus {
+				t.Errorf("expected status %d, got %d", tc.wantStatus, res.StatusCode)
+			}
+			if n := s.requests(); n != tc.wantRequests {
+				t.Errorf("expected %d requests, got %d", tc.wantRequests, n)
+			}
+		})
+	}
+}
+
+func TestTransportIdempotency(t *testing.T) {
+	for _, tc := range [...]struct {
+		name         string
+		method       string
+		header       []string
+		wantRequests int
+	}{
+		{
+			name:         "GET",
+			method:       http.MethodGet,
+			wantRequests: 2,
+		},
+		{
+			name:         "HEAD",
+			method:       http.MethodHead,
+			wantRequests: 2,
+		},
+		{
+			name:         "POST",
+			method:       http.MethodPost,
+			wantRequests: 1,
+		},
+		{
+			name:         "POST with an idempotency key",
+			method:       http.MethodPost,
+			header:       []string{"Idempotency-Key", "abc"},
+			wantRequests: 2,
+		},
+		{
+			name:         "PATCH with an X-Idempotency-Key",
+			method:       http.MethodPatch,
+			header:       []string{"X-Idempotency-Key", "abc"},
+			wantRequests: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &script{handlers: []http.HandlerFunc{status(http.StatusBadGateway), status(http.StatusOK)}}
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			do(t, newClient(&retry.Transport{}), tc.method, server.URL, "", tc.header...)
+			if n := s.requests(); n != tc.wantRequests {
+				t.Errorf("expected %d requests, got %d", tc.wantRequests, n)
+			}
+		})
+	}
+}
+
+func TestTransportRateLimitAnyMethod(t *testing.T) {
+	s := &script{handlers: []http.HandlerFunc{status(http.StatusTooManyRequests, "Retry-After", "0"), status(http.StatusCreated)}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	// The server did not process the request: it is safe to send again.
+	if res := do(t, newClient(&retry.Transport{}), http.MethodPost, server.URL, "payload"); res.StatusCode != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, res.StatusCode)
+	}
+	if n := s.requests(); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestTransportMaxAttempts(t *testing.T) {
+	s := &script{handlers: []http.HandlerFunc{status(http.StatusServiceUnavailable)}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	res := do(t, newClient(&retry.Transport{MaxAttempts: 3}), http.MethodGet, server.URL, "")
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the last response to be returned, got %d", res.StatusCode)
+	}
+	if n := s.requests(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestTransportBackoffCap(t *testing.T) {
+	s := &script{handlers: []http.HandlerFunc{status(http.StatusServiceUnavailable)}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	// Uncapped, the 4 waits would take at least 50+100+200+400ms.
+	start := time.Now()
+	do(t, newClient(&retry.Transport{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 100 * time.Millisecond}), http.MethodGet, server.URL, "")
+	if elapsed := time.Since(start); elapsed > 700*time.Millisecond {
+		t.Errorf("expected the backoff to be capped, waited %s", elapsed)
+	}
+	if n := s.requests(); n != 5 {
+		t.Errorf("expected 5 requests, got %d", n)
+	}
+}
+
+func TestTransportBodyReplay(t *testing.T) {
+	s := &script{handlers: []http.HandlerFunc{status(http.StatusInternalServerError), status(http.StatusOK)}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	do(t, newClient(&retry.Transport{}), http.MethodPut, server.URL, `{"state":"closed"}`)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.bodies) != 2 || s.bodies[0] != `{"state":"closed"}` || s.bodies[1] != s.bodies[0] {
+		t.Errorf("expected the body to be sent again, got %q", s.bodies)
+	}
+}
+
+func TestTransportRateLimitResource(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	s := &script{handlers: []http.HandlerFunc{
+		status(http.StatusOK, "X-RateLimit-Resource", "search", "X-RateLimit-Remaining", "0", "X-RateLimit-Reset", reset),
+		status(http.StatusOK),
+	}}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	client := newClient(&retry.Transport{MaxWait: time.Minute})
+
+	do(t, client, http.MethodGet, server.URL+"/search/issues", "")
+
+	// The other resources are not held.
+	for _, path := range []string{"/repos/o/r/issues", "/graphql"} {
+		if res := do(t, client, http.MethodGet, server.URL+path, ""); res.StatusCode != http.StatusOK {
+			t.Errorf("expected %s to be sent, got status %d", path, res.StatusCode)
+		}
+	}
+	if n := s.requests(); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+
+	// The exhausted resource is held until the reset, beyond MaxWait.
+	if _, err := client.Get(server.URL + "/search/issues"); err == nil {
+		t.Errorf("expected the search to be held")
+	}
+	if n := s.requests(); n != 3 {
+		t.Errorf("expected the search not to be sent, got %d requests", n)
+	}
+}
@@ -0,0 +1,72 @@
+package reverse
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/shiftstack/bugwatcher/pkg/team"
+	"github.com/shiftstack/ghira/pkg/github"
+)
+
+// AssigneeSync assigns the Github issues to the team member their Jira issue
+// is assigned to.
+//
+// The previous Jira assignee, if a team member, is removed from the Github
+// assignees; other Github assignees are left in place. Jira assignees who are
+// not in the team can't be mapped to a Github user, and are ignored.
+type AssigneeSync struct {
+	Github Github
+
+	// People maps Jira accounts to Github handles.
+	People []team.Person
+}
+
+var _ Handler = (*AssigneeSync)(nil)
+
+func (s *AssigneeSync) Handle(ctx context.Context, event Event) error {
+	if event.Kind != IssueUpdated {
+		return nil
+	}
+	i := slices.IndexFunc(event.Changes, func(c Change) bool { return c.Field == "assignee" })
+	if i < 0 {
+		return nil
+	}
+	change := event.Changes[i]
+	logger := slog.With("gh_number", event.Number, "jira_key", event.Key, "action", "assign")
+
+	var add, remove string
+	if person, ok := team.PersonByJiraAccountID(s.People, change.ToID); ok {
+		add = person.Github
+	} else if change.ToID != "" {
+		logger.Warn("The Jira assignee is not in the team: not assigning on Github", "assignee", change.To)
+	}
+	if person, ok := team.PersonByJiraAccountID(s.People, change.FromID); ok && person.Github != add {
+		remove = person.Github
+	}
+	if add == "" && remove == "" {
+		return nil
+	}
+
+	issue, err := s.Github.Issue(ctx, event.Number)
+	if err != nil {
+		return err
+	}
+	assigned := func(handle string) bool {
+		return slices.ContainsFunc(issue.Assignees, func(u github.User) bool { return u.Handle == handle })
+	}
+
+	if add != "" && !assigned(add) {
+		if err := s.Github.AddAssignees(ctx, event.Number, add); err != nil {
+			return err
+		}
+		logger.Info("Assigned Github issue", "assignee", add)
+	}
+	if remove != "" && assigned(remove) {
+		if err := s.Github.RemoveAssignees(ctx, event.Number, remove); err != nil {
+			return err
+		}
+		logger.Info("Unassigned Github issue", "assignee", remove)
+	}
+	return nil
+}
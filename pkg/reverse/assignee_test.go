@@ -0,0 +1,86 @@
+package reverse_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/shiftstack/bugwatcher/pkg/team"
+	"github.com/shiftstack/ghira/pkg/reverse"
+)
+
+func TestAssigneeSync(t *testing.T) {
+	people := []team.Person{
+		{Github: "alice", JiraAccountID: "alice-id"},
+		{Github: "bob", JiraAccountID: "bob-id"},
+	}
+	reassigned := func(from, to string) reverse.Event {
+		return reverse.Event{
+			Kind:    reverse.IssueUpdated,
+			Number:  1,
+			Key:     "OSASINFRA-1",
+			Changes: []reverse.Change{{Field: "assignee", FromID: from, ToID: to}},
+		}
+	}
+
+	for _, tc := range [...]struct {
+		name          string
+		assignees     []string
+		event         reverse.Event
+		wantCalls     []string
+		wantAssignees []string
+	}{
+		{
+			name:          "reassigned",
+			assignees:     []string{"alice", "outsider"},
+			event:         reassigned("alice-id", "bob-id"),
+			wantCalls:     []string{"assign bob", "unassign alice"},
+			wantAssignees: []string{"outsider", "bob"},
+		},
+		{
+			name:          "assigned",
+			event:         reassigned("", "alice-id"),
+			wantCalls:     []string{"assign alice"},
+			wantAssignees: []string{"alice"},
+		},
+		{
+			name:      "unassigned",
+			assignees: []string{"alice"},
+			event:     reassigned("alice-id", ""),
+			wantCalls: []string{"unassign alice"},
+		},
+		{
+			name:          "already assigned",
+			assignees:     []string{"bob"},
+			event:         reassigned("alice-id", "bob-id"),
+			wantAssignees: []string{"bob"},
+		},
+		{
+			name:      "assignee not in the team",
+			assignees: []string{"alice"},
+			event:     reassigned("alice-id", "mallory-id"),
+			wantCalls: []string{"unassign alice"},
+		},
+		{
+			name:          "other field",
+			assignees:     []string{"alice"},
+			event:         reverse.Event{Kind: reverse.IssueUpdated, Changes: []reverse.Change{{Field: "priority"}}},
+			wantAssignees: []string{"alice"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gh := &fakeGithub{assignees: tc.assignees}
+			s := &reverse.AssigneeSync{Github: gh, People: people}
+
+			if err := s.Handle(context.Background(), tc.event); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(gh.calls, tc.wantCalls) {
+				t.Errorf("expected calls %q, got %q", tc.wantCalls, gh.calls)
+			}
+			if !slices.Equal(gh.assignees, tc.wantAssignees) {
+				t.Errorf("expected assignees %q, got %q", tc.wantAssignees, gh.assignees)
+			}
+		})
+	}
+}
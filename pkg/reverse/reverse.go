@@ -0,0 +1,128 @@
+// Package reverse carries the changes made in Jira back to the mirrored
+// Github issues.
+package reverse
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/github"
+)
+
+// Event kinds.
+const (
+	IssueUpdated   = "issue_updated"
+	CommentCreated = "comment_created"
+)
+
+// Event is a change made to a Jira issue that mirrors a Github issue.
+type Event struct {
+	Kind string
+
+	// Number is the Github issue mirrored by the Jira issue Key.
+	Number int
+	Key    string
+
+	// Actor is the account ID of the Jira user who made the change.
+	Actor string
+	At    time.Time
+
+	// Status is the status of the Jira issue after the change, and
+	// StatusCategory the key of its category: "new", "indeterminate" or
+	// "done".
+	Status         string
+	StatusCategory string
+
+	// Resolution is the resolution of the Jira issue after the change, if
+	// any.
+	Resolution string
+
+	// Changes lists the fields changed by an IssueUpdated event.
+	Changes []Change
+
+	// Comment is the comment added by a CommentCreated event.
+	Comment *Comment
+}
+
+// Change is the change of a Jira field. From and To are the display
+// values; FromID and ToID are the raw values, such as account IDs.
+type Change struct {
+	Field  string
+	From   string
+	To     string
+	FromID string
+	ToID   string
+}
+
+// Comment is a Jira comment.
+type Comment struct {
+	ID     string
+	Author string
+	Body   string
+}
+
+// Github is the part of the Github API used by the reverse sync.
+type Github interface {
+	Issue(ctx context.Context, number int) (github.Issue, error)
+	SetState(ctx context.Context, number int, state, stateReason string) error
+	AddComment(ctx context.Context, number int, body string) error
+	AddAssignees(ctx context.Context, number int, handles ...string) error
+	RemoveAssignees(ctx context.Context, number int, handles ...string) error
+}
+
+// Handler acts on the events.
+type Handler interface {
+	Handle(ctx context.Context, event Event) error
+}
+
+// HandlerFunc adapts a function to the Handler interface.
+type HandlerFunc func(ctx context.Context, event Event) error
+
+func (f HandlerFunc) Handle(ctx context.Context, event Event) error { return f(ctx, event) }
+
+// Pipeline passes the submitted events to each of its handlers, one event at
+// a time, in the order they were submitted.
+type Pipeline struct {
+	handlers []Handler
+	events   chan Event
+}
+
+// NewPipeline returns a pipeline holding up to size events waiting to be
+// handled.
+func NewPipeline(size int, handlers ...Handler) *Pipeline {
+	return &Pipeline{
+		handlers: handlers,
+		events:   make(chan Event, size),
+	}
+}
+
+// Submit enqueues an event. It doesn't block; it returns false if the
+// pipeline is full.
+func (p *Pipeline) Submit(event Event) bool {
+	select {
+	case p.events <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run handles the submitted events until ctx is cancelled. The errors of a
+// handler are logged, and don't prevent the next handlers from running.
+func (p *Pipeline) Run(ctx context.Context) {
+	for {
+		select {
+		case event := <-p.events:
+			logger := slog.With("gh_number", event.Number, "jira_key", event.Key, "event", event.Kind)
+			logger.Debug("Handling Jira event", "changes", len(event.Changes))
+			for _, h := range p.handlers {
+				if err := h.Handle(ctx, event); err != nil {
+					logger.Error("Unable to handle Jira event", "error", err)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
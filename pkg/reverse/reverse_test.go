@@ -0,0 +1,48 @@
+package reverse_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/shiftstack/ghira/pkg/github"
+)
+
+// fakeGithub records the writes to a single issue.
+type fakeGithub struct {
+	status    string
+	assignees []string
+
+	calls []string
+}
+
+func (g *fakeGithub) Issue(_ context.Context, number int) (github.Issue, error) {
+	issue := github.Issue{Number: number, Status: g.status}
+	for _, a := range g.assignees {
+		issue.Assignees = append(issue.Assignees, github.User{Handle: a})
+	}
+	return issue, nil
+}
+
+func (g *fakeGithub) SetState(_ context.Context, _ int, state, stateReason string) error {
+	g.status = state
+	g.calls = append(g.calls, "state "+state+" "+stateReason)
+	return nil
+}
+
+func (g *fakeGithub) AddComment(_ context.Context, _ int, body string) error {
+	g.calls = append(g.calls, "comment "+body)
+	return nil
+}
+
+func (g *fakeGithub) AddAssignees(_ context.Context, _ int, handles ...string) error {
+	g.assignees = append(g.assignees, handles...)
+	g.calls = append(g.calls, "assign "+strings.Join(handles, ","))
+	return nil
+}
+
+func (g *fakeGithub) RemoveAssignees(_ context.Context, _ int, handles ...string) error {
+	g.assignees = slices.DeleteFunc(g.assignees, func(a string) bool { return slices.Contains(handles, a) })
+	g.calls = append(g.calls, "unassign "+strings.Join(handles, ","))
+	return nil
+}
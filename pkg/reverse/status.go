@@ -0,0 +1,141 @@
+package reverse
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+
+	"github.com/shiftstack/ghira/pkg/config"
+)
+
+// StatusSync closes and reopens the Github issues to follow the status of
+// their Jira issue, as configured by the rules.
+//
+// A Github issue is closed when its Jira issue moves to a status of the
+// "done" category, with the state reason of the first close rule matching
+// the Jira resolution. It is reopened when the resolution of its Jira issue
+// is cleared, which Jira does when an issue leaves the "done" category.
+type StatusSync struct {
+	Github Github
+	Rules  config.Reverse
+
+	// JiraBaseURL is used to link to the Jira issue in the comments.
+	JiraBaseURL string
+}
+
+var _ Handler = (*StatusSync)(nil)
+
+// commentData is passed to the comment templates.
+type commentData struct {
+	Key        string
+	URL        string
+	Status     string
+	Resolution string
+}
+
+func (s *StatusSync) Handle(ctx context.Context, event Event) error {
+	if event.Kind != IssueUpdated {
+		return nil
+	}
+
+	var closing, reopening bool
+	for _, c := range event.Changes {
+		switch {
+		case c.Field == "status" && event.StatusCategory == "done":
+			closing = true
+		case c.Field == "resolution" && c.FromID != "" && c.ToID == "" && event.StatusCategory != "done":
+			reopening = true
+		}
+	}
+
+	switch {
+	case closing && len(s.Rules.Close) > 0:
+		return s.close(ctx, event)
+	case reopening && s.Rules.Reopen != nil:
+		return s.reopen(ctx, event)
+	}
+	return nil
+}
+
+func (s *StatusSync) close(ctx context.Context, event Event) error {
+	logger := slog.With("gh_number", event.Number, "jira_key", event.Key, "action", "close")
+
+	var rule *config.CloseRule
+	for i := range s.Rules.Close {
+		if s.Rules.Close[i].Matches(event.Resolution) {
+			rule = &s.Rules.Close[i]
+			break
+		}
+	}
+	if rule == nil {
+		logger.Debug("No close rule for the Jira resolution", "resolution", event.Resolution)
+		return nil
+	}
+
+	issue, err := s.Github.Issue(ctx, event.Number)
+	if err != nil {
+		return err
+	}
+	if issue.Status == "closed" {
+		logger.Debug("Github issue already closed")
+		return nil
+	}
+
+	comment, err := s.comment(rule.Comment, event)
+	if err != nil {
+		return err
+	}
+	if err := s.Github.AddComment(ctx, event.Number, comment); err != nil {
+		return err
+	}
+	if err := s.Github.SetState(ctx, event.Number, "closed", rule.StateReason); err != nil {
+		return err
+	}
+	logger.Info("Closed Github issue", "resolution", event.Resolution, "state_reason", rule.StateReason)
+	return nil
+}
+
+func (s *StatusSync) reopen(ctx context.Context, event Event) error {
+	logger := slog.With("gh_number", event.Number, "jira_key", event.Key, "action", "reopen")
+
+	issue, err := s.Github.Issue(ctx, event.Number)
+	if err != nil {
+		return err
+	}
+	if issue.Status != "closed" {
+		logger.Debug("Github issue already open")
+		return nil
+	}
+
+	comment, err := s.comment(s.Rules.Reopen.Comment, event)
+	if err != nil {
+		return err
+	}
+	if err := s.Github.AddComment(ctx, event.Number, comment); err != nil {
+		return err
+	}
+	if err := s.Github.SetState(ctx, event.Number, "open", ""); err != nil {
+		return err
+	}
+	logger.Info("Reopened Github issue", "status", event.Status)
+	return nil
+}
+
+func (s *StatusSync) comment(text string, event Event) (string, error) {
+	tmpl, err := template.New("comment").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid comment template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, commentData{
+		Key:        event.Key,
+		URL:        strings.TrimSuffix(s.JiraBaseURL, "/") + "/browse/" + event.Key,
+		Status:     event.Status,
+		Resolution: event.Resolution,
+	}); err != nil {
+		return "", fmt.Errorf("error rendering the comment: %w", err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,116 @@
+package reverse_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/shiftstack/ghira/pkg/config"
+	"github.com/shiftstack/ghira/pkg/reverse"
+)
+
+func TestStatusSync(t *testing.T) {
+	rules := config.Reverse{
+		Close: []config.CloseRule{
+			{Resolutions: []string{"Won't Do"}, StateReason: "not_planned", Comment: "{{.Key}} {{.Resolution}} {{.URL}}"},
+			{Resolutions: []string{"Done"}, StateReason: "completed", Comment: "done"},
+		},
+		Reopen: &config.ReopenRule{Comment: "reopened in {{.Status}}"},
+	}
+	closedAs := func(resolution string) reverse.Event {
+		return reverse.Event{
+			Kind:           reverse.IssueUpdated,
+			Number:         1,
+			Key:            "OSASINFRA-1",
+			Status:         "Closed",
+			StatusCategory: "done",
+			Resolution:     resolution,
+			Changes: []reverse.Change{
+				{Field: "resolution", To: resolution, ToID: "10"},
+				{Field: "status", From: "To Do", To: "Closed", FromID: "1", ToID: "2"},
+			},
+		}
+	}
+	reopened := reverse.Event{
+		Kind:           reverse.IssueUpdated,
+		Number:         1,
+		Key:            "OSASINFRA-1",
+		Status:         "To Do",
+		StatusCategory: "new",
+		Changes: []reverse.Change{
+			{Field: "resolution", From: "Done", FromID: "10"},
+			{Field: "status", From: "Closed", To: "To Do", FromID: "2", ToID: "1"},
+		},
+	}
+
+	for _, tc := range [...]struct {
+		name      string
+		rules     config.Reverse
+		status    string
+		event     reverse.Event
+		wantCalls []string
+	}{
+		{
+			name:      "closed as Won't Do",
+			rules:     rules,
+			status:    "open",
+			event:     closedAs("Won't Do"),
+			wantCalls: []string{"comment OSASINFRA-1 Won't Do https://jira.example.com/browse/OSASINFRA-1", "state closed not_planned"},
+		},
+		{
+			name:      "closed as Done",
+			rules:     rules,
+			status:    "open",
+			event:     closedAs("Done"),
+			wantCalls: []string{"comment done", "state closed completed"},
+		},
+		{
+			name:   "resolution without a rule",
+			rules:  rules,
+			status: "open",
+			event:  closedAs("Duplicate"),
+		},
+		{
+			name:   "already closed",
+			rules:  rules,
+			status: "closed",
+			event:  closedAs("Done"),
+		},
+		{
+			name:   "reverse sync disabled",
+			status: "open",
+			event:  closedAs("Done"),
+		},
+		{
+			name:      "reopened",
+			rules:     rules,
+			status:    "closed",
+			event:     reopened,
+			wantCalls: []string{"comment reopened in To Do", "state open "},
+		},
+		{
+			name:   "reopen disabled",
+			rules:  config.Reverse{Close: rules.Close},
+			status: "closed",
+			event:  reopened,
+		},
+		{
+			name:   "comment",
+			rules:  rules,
+			status: "open",
+			event:  reverse.Event{Kind: reverse.CommentCreated, Number: 1, StatusCategory: "done", Comment: &reverse.Comment{Body: "hi"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gh := &fakeGithub{status: tc.status}
+			s := &reverse.StatusSync{Github: gh, Rules: tc.rules, JiraBaseURL: "https://jira.example.com/"}
+
+			if err := s.Handle(context.Background(), tc.event); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(gh.calls, tc.wantCalls) {
+				t.Errorf("expected calls %q, got %q", tc.wantCalls, gh.calls)
+			}
+		})
+	}
+}
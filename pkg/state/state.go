@@ -0,0 +1,402 @@
+// Package state stores, in a local file, the Jira issue that mirrors each
+// Github issue and the field values recorded at its last sync.
+//
+// The store is a cache of what ghira keeps in Jira: when it is lost, it can be
+// rebuilt from the Jira issues.
+package state
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// SchemaVersion is the version of the file format written by this version of
+// ghira.
+const SchemaVersion = 1
+
+// migrations[v] upgrades a document from version v to version v+1. Documents
+// are migrated in their generic JSON form, before being decoded.
+var migrations = map[int]func(document map[string]any) error{}
+
+// Issue is the state of a Github issue mirrored in Jira.
+type Issue struct {
+	Repository string `json:"repository"`
+	Number     int    `json:"number"`
+	Key        string `json:"jira_key"`
+
+	// Synced holds the field values recorded at the last sync, if any.
+	Synced map[string]string `json:"synced,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ref identifies a Github issue.
+type ref struct {
+	repository string
+	number     int
+}
+
+// document is the content of the state file.
+type document struct {
+	Version int     `json:"version"`
+	Issues  []Issue `json:"issues"`
+}
+
+// Store holds the state in memory. Changes are written to the file by Save,
+// merged with the changes saved by other processes since. It is safe for
+// concurrent use.
+type Store struct {
+	path string
+
+	// saving serializes the writes of the file, so that an older snapshot
+	// never replaces a newer one.
+	saving sync.Mutex
+
+	mu     sync.Mutex
+	issues map[ref]Issue
+	byKey  map[string]ref
+	dirty  bool
+
+	// touched holds the issues changed since the last Save, and replaced
+	// is set when the whole content was imported: the other issues are
+	// taken from the file when saving.
+	touched  map[ref]bool
+	replaced bool
+
+	// generation counts the changes, so that Save can tell whether the
+	// store changed while it was writing.
+	generation uint64
+}
+
+// Open loads the store at path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	issues, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	s.reset(issues)
+	return s, nil
+}
+
+func (s *Store) reset(issues []Issue) {
+	s.issues = make(map[ref]Issue, len(issues))
+	s.byKey = make(map[string]ref, len(issues))
+	s.touched = make(map[ref]bool)
+	for _, issue := range issues {
+		s.put(issue)
+	}
+}
+
+func (s *Store) put(issue Issue) {
+	r := ref{issue.Repository, issue.Number}
+	if old, ok := s.issues[r]; ok && old.Key != issue.Key {
+		delete(s.byKey, old.Key)
+	}
+	s.issues[r] = issue
+	s.byKey[issue.Key] = r
+}
+
+func (s *Store) remove(r ref) {
+	if issue, ok := s.issues[r]; ok {
+		delete(s.issues, r)
+		delete(s.byKey, issue.Key)
+	}
+}
+
+// load reads the file, if it exists.
+func (s *Store) load() ([]Issue, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	issues, err := decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", s.path, err)
+	}
+	return issues, nil
+}
+
+// decode reads a document of any known version.
+func decode(r io.Reader) ([]Issue, error) {
+	var generic map[string]any
+	if err := json.NewDecoder(r).Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	version, ok := generic["version"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("missing schema version")
+	}
+	if int(version) > SchemaVersion {
+		return nil, fmt.Errorf("schema version %d is newer than the supported version %d", int(version), SchemaVersion)
+	}
+	for v := int(version); v < SchemaVersion; v++ {
+		migrate, ok := migrations[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration from schema version %d", v)
+		}
+		if err := migrate(generic); err != nil {
+			return nil, fmt.Errorf("error migrating from schema version %d: %w", v, err)
+		}
+		generic["version"] = v + 1
+	}
+
+	b, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+	var doc document
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	for _, issue := range doc.Issues {
+		if issue.Repository == "" || issue.Number < 1 || issue.Key == "" {
+			return nil, fmt.Errorf("invalid issue %s#%d (%s)", issue.Repository, issue.Number, issue.Key)
+		}
+	}
+	return doc.Issues, nil
+}
+
+// Issue returns the state of a Github issue.
+func (s *Store) Issue(repository string, number int) (Issue, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issue, ok := s.issues[ref{repository, number}]
+	return issue, ok
+}
+
+// IssueByKey returns the state of the Github issue mirrored by a Jira issue.
+func (s *Store) IssueByKey(key string) (Issue, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.byKey[key]
+	if !ok {
+		return Issue{}, false
+	}
+	return s.issues[r], true
+}
+
+// Issues returns all the issues, ordered by repository and number.
+func (s *Store) Issues() []Issue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sorted()
+}
+
+func (s *Store) sorted() []Issue {
+	return slices.SortedFunc(maps.Values(s.issues), func(a, b Issue) int {
+		return cmp.Or(cmp.Compare(a.Repository, b.Repository), cmp.Compare(a.Number, b.Number))
+	})
+}
+
+// SetKey records the Jira issue that mirrors a Github issue. The synced
+// values are forgotten if the Jira issue changes.
+func (s *Store) SetKey(repository string, number int, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issue, ok := s.issues[ref{repository, number}]
+	if ok && issue.Key == key {
+		return
+	}
+	s.put(Issue{Repository: repository, Number: number, Key: key, UpdatedAt: time.Now().UTC()})
+	s.changed(ref{repository, number})
+}
+
+// SetSynced records the field values of a Github issue after a sync.
+func (s *Store) SetSynced(repository string, number int, key string, synced map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issue, ok := s.issues[ref{repository, number}]
+	if ok && issue.Key == key && maps.Equal(issue.Synced, synced) {
+		return
+	}
+	s.put(Issue{Repository: repository, Number: number, Key: key, Synced: maps.Clone(synced), UpdatedAt: time.Now().UTC()})
+	s.changed(ref{repository, number})
+}
+
+// changed marks an issue as modified. The caller holds s.mu.
+func (s *Store) changed(r ref) {
+	s.touched[r] = true
+	s.dirty = true
+	s.generation++
+}
+
+// Delete forgets a Github issue.
+func (s *Store) Delete(repository string, number int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := ref{repository, number}
+	if _, ok := s.issues[r]; ok {
+		s.remove(r)
+		s.changed(r)
+	}
+}
+
+// Export writes the store as indented JSON.
+func (s *Store) Export(w io.Writer) error {
+	return encode(w, s.Issues())
+}
+
+func encode(w io.Writer, issues []Issue) error {
+	if issues == nil {
+		issues = []Issue{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(document{Version: SchemaVersion, Issues: issues})
+}
+
+// Import replaces the content of the store with an exported document, of
+// any supported version.
+func (s *Store) Import(r io.Reader) error {
+	issues, err := decode(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset(issues)
+	s.replaced = true
+	s.dirty = true
+	s.generation++
+	return nil
+}
+
+// Save writes the changes to the file. The file is read again first, under
+// a lock, and the issues that were not changed in the store are taken from
+// it, so that the changes saved by other processes are kept. The file is
+// replaced atomically, so that it is never left half-written.
+func (s *Store) Save() error {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+
+	if !s.isDirty() {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	unlock, err := s.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	saved, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	// The changes made after the snapshot are not in the file: the store
+	// then stays dirty for the next Save.
+	s.mu.Lock()
+	generation := s.generation
+	merged := make(map[ref]Issue, len(saved))
+	if !s.replaced {
+		for _, issue := range saved {
+			merged[ref{issue.Repository, issue.Number}] = issue
+		}
+	}
+	for r, issue := range s.issues {
+		if s.replaced || s.touched[r] {
+			merged[r] = issue
+		}
+	}
+	for r := range s.touched {
+		if _, ok := s.issues[r]; !ok {
+			delete(merged, r)
+		}
+	}
+	s.mu.Unlock()
+
+	issues := slices.SortedFunc(maps.Values(merged), func(a, b Issue) int {
+		return cmp.Or(cmp.Compare(a.Repository, b.Repository), cmp.Compare(a.Number, b.Number))
+	})
+	if err := s.write(issues); err != nil {
+		return err
+	}
+
+	// The issues saved by the other processes are adopted.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for r := range s.issues {
+		if _, ok := merged[r]; !ok && !s.touched[r] {
+			s.remove(r)
+		}
+	}
+	for r, issue := range merged {
+		if !s.touched[r] {
+			s.put(issue)
+		}
+	}
+	if s.generation == generation {
+		s.dirty, s.replaced = false, false
+		clear(s.touched)
+	}
+	return nil
+}
+
+func (s *Store) isDirty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dirty
+}
+
+// lockFile locks the file path+".lock" with flock(2), so that the processes
+// sharing the file save one at a time.
+func (s *Store) lockFile() (func(), error) {
+	f, err := os.OpenFile(s.path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error locking %s: %w", s.path, err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// write replaces the file with the issues.
+func (s *Store) write(issues []Issue) error {
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := encode(f, issues); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
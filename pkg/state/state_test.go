@@ -0,0 +1,376 @@
+package state_test
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shiftstack/ghira/pkg/github"
+	"github.com/shiftstack/ghira/pkg/reconcile"
+	"github.com/shiftstack/ghira/pkg/reconcile/fake"
+	"github.com/shiftstack/ghira/pkg/state"
+)
+
+func TestStoreSaveAndOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "ghira.json")
+
+	store, err := state.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening a missing file: %v", err)
+	}
+	store.SetKey("o/r", 1, "OSASINFRA-1")
+	store.SetSynced("o/r", 2, "OSASINFRA-2", map[string]string{"summary": "Crash"})
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := state.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issue, ok := reopened.Issue("o/r", 1); !ok || issue.Key != "OSASINFRA-1" {
+		t.Errorf("expected #1 to map to OSASINFRA-1, got %+v", issue)
+	}
+	if issue, ok := reopened.IssueByKey("OSASINFRA-2"); !ok || issue.Number != 2 || issue.Synced["summary"] != "Crash" {
+		t.Errorf("expected OSASINFRA-2 to map to #2 with its synced values, got %+v", issue)
+	}
+
+	// A new Jira issue invalidates the synced values.
+	reopened.SetKey("o/r", 2, "OSASINFRA-3")
+	if issue, _ := reopened.Issue("o/r", 2); issue.Synced != nil {
+		t.Errorf("expected the synced values to be forgotten, got %v", issue.Synced)
+	}
+	if _, ok := reopened.IssueByKey("OSASINFRA-2"); ok {
+		t.Errorf("expected OSASINFRA-2 to be forgotten")
+	}
+}
+
+func TestStoreExportImport(t *testing.T) {
+	store, err := state.Open(filepath.Join(t.TempDir(), "a.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetSynced("o/r", 1, "OSASINFRA-1", map[string]string{"status": "open"})
+
+	var buf bytes.Buffer
+	if err := store.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := state.Open(filepath.Join(t.TempDir(), "b.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported.SetKey("o/r", 9, "OSASINFRA-9")
+	if err := imported.Import(&buf); err != nil {
+		t.Fatal(err)
+	}
+	issues := imported.Issues()
+	if len(issues) != 1 || issues[0].Key != "OSASINFRA-1" || issues[0].Synced["status"] != "open" {
+		t.Errorf("expected the import to replace the content, got %+v", issues)
+	}
+}
+
+func TestStoreImportInvalid(t *testing.T) {
+	for _, tc := range [...]struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{
+			name:    "newer version",
+			in:      `{"version": 99, "issues": []}`,
+			wantErr: "newer than the supported version",
+		},
+		{
+			name:    "no version",
+			in:      `{"issues": []}`,
+			wantErr: "missing schema version",
+		},
+		{
+			name:    "unknown old version",
+			in:      `{"version": 0, "issues": []}`,
+			wantErr: "no migration from schema version 0",
+		},
+		{
+			name:    "issue without key",
+			in:      `{"version": 1, "issues": [{"repository": "o/r", "number": 1}]}`,
+			wantErr: "invalid issue",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Import(strings.NewReader(tc.in)); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped := &fake.Tracker{
+		Known:  map[int]reconcile.KnownIssue{1: {Key: "OSASINFRA-1"}},
+		Synced: map[string]reconcile.FieldValues{"OSASINFRA-1": {"summary": "Crash"}},
+	}
+	tracker := &state.Tracker{Tracker: wrapped, Store: store, Repository: "o/r"}
+
+	if _, err := tracker.KnownIssues(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if issue, ok := store.Issue("o/r", 1); !ok || issue.Key != "OSASINFRA-1" {
+		t.Fatalf("expected the known issue to be recorded, got %+v", issue)
+	}
+
+	// The values recorded in the tracker are copied to the store.
+	synced, err := tracker.SyncedFields(ctx, "OSASINFRA-1")
+	if err != nil || synced["summary"] != "Crash" {
+		t.Fatalf("expected the synced values of the tracker, got %v, %v", synced, err)
+	}
+	delete(wrapped.Synced, "OSASINFRA-1")
+	if synced, _ := tracker.SyncedFields(ctx, "OSASINFRA-1"); synced["summary"] != "Crash" {
+		t.Errorf("expected the synced values to be served from the store, got %v", synced)
+	}
+
+	// The tracker is authoritative: another process synced the issue.
+	wrapped.Synced["OSASINFRA-1"] = reconcile.FieldValues{"summary": "Crash on start"}
+	if synced, _ := tracker.SyncedFields(ctx, "OSASINFRA-1"); synced["summary"] != "Crash on start" {
+		t.Errorf("expected the synced values of the tracker, got %v", synced)
+	}
+	if issue, _ := store.Issue("o/r", 1); issue.Synced["summary"] != "Crash on start" {
+		t.Errorf("expected the store to be updated from the tracker, got %v", issue.Synced)
+	}
+
+	want := reconcile.FieldValues{"summary": "Crash on boot"}
+	if err := tracker.SetSyncedFields(ctx, "OSASINFRA-1", want); err != nil {
+		t.Fatal(err)
+	}
+	if issue, _ := store.Issue("o/r", 1); !maps.Equal(issue.Synced, want) {
+		t.Errorf("expected %v in the store, got %v", want, issue.Synced)
+	}
+	if got := wrapped.Synced["OSASINFRA-1"]; !maps.Equal(got, want) {
+		t.Errorf("expected %v in the tracker, got %v", want, got)
+	}
+
+	if err := tracker.Relink(ctx, "OSASINFRA-1", github.Issue{Number: 5, URL: "https://github.com/o/other/issues/5"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Issue("o/r", 1); ok {
+		t.Errorf("expected the relinked issue to be forgotten")
+	}
+
+	key, err := tracker.Create(ctx, ghIssue(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issue, ok := store.Issue("o/r", 2); !ok || issue.Key != key {
+		t.Errorf("expected the created issue to be recorded as %s, got %+v", key, issue)
+	}
+}
+
+// keyedTracker fetches the issues by key, and counts the searches of all the
+// issues.
+type keyedTracker struct {
+	*fake.Tracker
+	searches int
+
+	// Indexed are the issues fetched by key, which the search doesn't
+	// find yet.
+	Indexed map[string]int
+}
+
+func (t *keyedTracker) KnownIssues(ctx context.Context) (map[int]reconcile.KnownIssue, error) {
+	t.searches++
+	return t.Tracker.KnownIssues(ctx)
+}
+
+func (t *keyedTracker) IssueByKey(_ context.Context, key string) (reconcile.KnownIssue, int, error) {
+	return reconcile.KnownIssue{Key: key}, t.Indexed[key], nil
+}
+
+func TestTrackerKnownIssues(t *testing.T) {
+	ctx := context.Background()
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped := &keyedTracker{Tracker: &fake.Tracker{
+		Known: map[int]reconcile.KnownIssue{1: {Key: "OSASINFRA-1"}, 2: {Key: "OSASINFRA-2"}},
+	}}
+	tracker := &state.Tracker{Tracker: wrapped, Store: store, Repository: "o/r"}
+
+	if known, err := tracker.KnownIssues(ctx); err != nil || len(known) != 2 {
+		t.Fatalf("expected 2 known issues, got %v, %v", known, err)
+	}
+
+	// Another issue was linked by hand, and a duplicate was filed: the
+	// issues are searched again even though they are recorded.
+	wrapped.Known[2] = reconcile.KnownIssue{Key: "OSASINFRA-5", Duplicates: []string{"OSASINFRA-2"}}
+	delete(wrapped.Known, 1)
+	known, err := tracker.KnownIssues(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrapped.searches != 2 {
+		t.Errorf("expected a search at each call, got %d", wrapped.searches)
+	}
+	if issue := known[2]; issue.Key != "OSASINFRA-5" || !slices.Equal(issue.Duplicates, []string{"OSASINFRA-2"}) {
+		t.Errorf("expected the linked issue with its duplicate, got %+v", issue)
+	}
+	if issue, _ := store.Issue("o/r", 2); issue.Key != "OSASINFRA-5" {
+		t.Errorf("expected the linked issue to be recorded, got %+v", issue)
+	}
+	if _, ok := store.Issue("o/r", 1); ok {
+		t.Errorf("expected the stale issue to be forgotten")
+	}
+}
+
+func TestTrackerKnownIssueHint(t *testing.T) {
+	ctx := context.Background()
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetKey("o/r", 1, "OSASINFRA-1")
+	store.SetKey("o/r", 2, "OSASINFRA-2")
+	wrapped := &keyedTracker{Tracker: &fake.Tracker{}, Indexed: map[string]int{"OSASINFRA-1": 1}}
+	tracker := &state.Tracker{Tracker: wrapped, Store: store, Repository: "o/r"}
+
+	// The search doesn't find the issue yet: it is fetched by key.
+	if issue, ok, err := tracker.KnownIssue(ctx, 1); err != nil || !ok || issue.Key != "OSASINFRA-1" {
+		t.Errorf("expected the recorded issue, got %+v, %t, %v", issue, ok, err)
+	}
+
+	// The recorded issue no longer mirrors the Github issue.
+	if issue, ok, err := tracker.KnownIssue(ctx, 2); err != nil || ok {
+		t.Errorf("expected no issue, got %+v, %t, %v", issue, ok, err)
+	}
+	if _, ok := store.Issue("o/r", 2); ok {
+		t.Errorf("expected the stale issue to be forgotten")
+	}
+}
+
+func TestStoreSaveMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	first, err := state.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.SetKey("o/r", 1, "OSASINFRA-1")
+	if err := first.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := state.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.SetKey("o/r", 2, "OSASINFRA-2")
+	first.Delete("o/r", 1)
+	if err := first.Save(); err != nil {
+		t.Fatal(err)
+	}
+	second.SetKey("o/r", 3, "OSASINFRA-3")
+	if err := second.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := state.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, issue := range reopened.Issues() {
+		keys = append(keys, issue.Key)
+	}
+	if want := []string{"OSASINFRA-2", "OSASINFRA-3"}; !slices.Equal(keys, want) {
+		t.Errorf("expected the changes of both stores %v, got %v", want, keys)
+	}
+	if _, ok := second.Issue("o/r", 2); !ok {
+		t.Errorf("expected the store to adopt the issues saved by the other one")
+	}
+	if _, ok := second.Issue("o/r", 1); ok {
+		t.Errorf("expected the store to adopt the issues deleted by the other one")
+	}
+}
+
+func TestStoreSaveConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := state.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for n := 1; n <= 50; n++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			store.SetKey("o/r", n, "OSASINFRA-"+strconv.Itoa(n))
+		}()
+		go func() {
+			defer wg.Done()
+			if err := store.Save(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := state.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issues := reopened.Issues(); len(issues) != 50 {
+		t.Errorf("expected the 50 issues to be saved, got %d", len(issues))
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	store, err := state.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetKey("o/r", 3, "OSASINFRA-3")
+	store.SetKey("other/repo", 3, "OTHER-3")
+
+	n, err := state.Rebuild(context.Background(), store, &fake.Tracker{
+		Known:  map[int]reconcile.KnownIssue{1: {Key: "OSASINFRA-1"}, 2: {Key: "OSASINFRA-2"}},
+		Synced: map[string]reconcile.FieldValues{"OSASINFRA-2": {"status": "closed"}},
+	}, "o/r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 issues, got %d", n)
+	}
+	if _, ok := store.Issue("o/r", 3); ok {
+		t.Errorf("expected the issues missing from the tracker to be forgotten")
+	}
+	if _, ok := store.Issue("other/repo", 3); !ok {
+		t.Errorf("expected the issues of other repositories to be kept")
+	}
+	if issue, _ := store.Issue("o/r", 2); issue.Synced["status"] != "closed" {
+		t.Errorf("expected the synced values to be rebuilt, got %+v", issue)
+	}
+}
+
+func ghIssue(number int) github.Issue {
+	return github.Issue{Number: number, Title: "Issue", Status: "open"}
+}
@@ -0,0 +1,161 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shiftstack/ghira/pkg/github"
+	"github.com/shiftstack/ghira/pkg/reconcile"
+)
+
+// Tracker records in a Store the issues of the tracker it wraps and their
+// synced values. The wrapped tracker is still searched for the known issues,
+// and the recorded issues are only used as a hint. The synced values are still written to the wrapped tracker, which remains
+// authoritative, so that the store can be rebuilt.
+type Tracker struct {
+	reconcile.Tracker
+
+	Store      *Store
+	Repository string
+}
+
+var _ reconcile.Tracker = (*Tracker)(nil)
+
+// keyLookup is implemented by the trackers that can fetch an issue by key. It
+// returns the number of the Github issue mirrored by the issue, or 0.
+type keyLookup interface {
+	IssueByKey(ctx context.Context, key string) (reconcile.KnownIssue, int, error)
+}
+
+// KnownIssues searches all the issues of the wrapped tracker, and records
+// them. The store is not used to skip the search: only the search finds the
+// other issues mirroring the same Github issues, and the issues linked by
+// hand or by other processes since.
+func (t *Tracker) KnownIssues(ctx context.Context) (map[int]reconcile.KnownIssue, error) {
+	known, err := t.Tracker.KnownIssues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for n, issue := range known {
+		t.Store.SetKey(t.Repository, n, issue.Key)
+	}
+	for _, issue := range t.Store.Issues() {
+		if _, ok := known[issue.Number]; !ok && issue.Repository == t.Repository {
+			t.Store.Delete(t.Repository, issue.Number)
+		}
+	}
+	return known, nil
+}
+
+// KnownIssue searches the issue in the wrapped tracker, and records it. The
+// recorded issue is only a hint, fetched by key if the search finds nothing,
+// as the search index of the tracker can lag behind the issues just created.
+func (t *Tracker) KnownIssue(ctx context.Context, number int) (reconcile.KnownIssue, bool, error) {
+	issue, ok, err := t.Tracker.KnownIssue(ctx, number)
+	if err != nil {
+		return issue, ok, err
+	}
+	if ok {
+		t.Store.SetKey(t.Repository, number, issue.Key)
+		return issue, true, nil
+	}
+
+	if lookup, isLookup := t.Tracker.(keyLookup); isLookup {
+		if recorded, isRecorded := t.Store.Issue(t.Repository, number); isRecorded {
+			issue, n, err := lookup.IssueByKey(ctx, recorded.Key)
+			if err != nil {
+				return reconcile.KnownIssue{}, false, err
+			}
+			if n == number {
+				return issue, true, nil
+			}
+			t.Store.Delete(t.Repository, number)
+		}
+	}
+	return reconcile.KnownIssue{}, false, nil
+}
+
+func (t *Tracker) Create(ctx context.Context, issue github.Issue) (string, error) {
+	key, err := t.Tracker.Create(ctx, issue)
+	if err == nil {
+		t.Store.SetKey(t.Repository, issue.Number, key)
+	}
+	return key, err
+}
+
+// SyncedFields reads the values recorded in the wrapped tracker, which is
+// authoritative: another process may have synced the issue since. The values
+// recorded in the store are only served when the tracker has none, for
+// example if they were recorded by an earlier version.
+func (t *Tracker) SyncedFields(ctx context.Context, key string) (reconcile.FieldValues, error) {
+	synced, err := t.Tracker.SyncedFields(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	issue, ok := t.Store.IssueByKey(key)
+	if !ok {
+		return synced, nil
+	}
+	if synced == nil {
+		return issue.Synced, nil
+	}
+	t.Store.SetSynced(issue.Repository, issue.Number, key, synced)
+	return synced, nil
+}
+
+func (t *Tracker) SetSyncedFields(ctx context.Context, key string, values reconcile.FieldValues) error {
+	if err := t.Tracker.SetSyncedFields(ctx, key, values); err != nil {
+		return err
+	}
+	if issue, ok := t.Store.IssueByKey(key); ok {
+		t.Store.SetSynced(issue.Repository, issue.Number, key, values)
+	}
+	return nil
+}
+
+// Relink forgets the issue: it no longer mirrors a Github issue of the
+// repository.
+func (t *Tracker) Relink(ctx context.Context, key string, issue github.Issue) error {
+	if err := t.Tracker.Relink(ctx, key, issue); err != nil {
+		return err
+	}
+	if recorded, ok := t.Store.IssueByKey(key); ok {
+		t.Store.Delete(recorded.Repository, recorded.Number)
+	}
+	return nil
+}
+
+// Rebuild replaces the issues of the repository in the store with the issues
+// of the tracker and the synced values recorded in them. It returns the
+// number of issues found.
+func Rebuild(ctx context.Context, store *Store, tracker reconcile.Tracker, repository string) (int, error) {
+	known, err := tracker.KnownIssues(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	issues := make([]Issue, 0, len(known))
+	for n, k := range known {
+		synced, err := tracker.SyncedFields(ctx, k.Key)
+		if err != nil {
+			return 0, fmt.Errorf("error fetching the synced values of %s: %w", k.Key, err)
+		}
+		issues = append(issues, Issue{Repository: repository, Number: n, Key: k.Key, Synced: synced, UpdatedAt: now})
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for r := range store.issues {
+		if r.repository == repository {
+			store.remove(r)
+			store.changed(r)
+		}
+	}
+	for _, issue := range issues {
+		store.put(issue)
+		store.changed(ref{issue.Repository, issue.Number})
+	}
+	return len(issues), nil
+}
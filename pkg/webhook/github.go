@@ -0,0 +1,151 @@
+// Package webhook receives webhook deliveries, so that changes are synced as
+// they happen rather than at the next scheduled run.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxPayloadSize is the largest payload Github delivers.
+const maxPayloadSize = 25 << 20
+
+// closingKeywordRegex matches the references to the issues that a pull
+// request closes when merged.
+//
+// https://docs.github.com/en/issues/tracking-your-work-with-issues/using-issues/linking-a-pull-request-to-an-issue
+var closingKeywordRegex = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?):?\s+#(\d+)\b`)
+
+// Github handles the issues, issue_comment and pull_request deliveries of a
+// Github webhook, and enqueues the affected issues for sync.
+type Github struct {
+	// Secret is the webhook secret, used to verify the X-Hub-Signature-256
+	// header.
+	Secret []byte
+
+	// Repository is the "owner/name" of the repository. Deliveries about
+	// other repositories are ignored.
+	Repository string
+
+	// Queue receives the numbers of the issues to sync.
+	Queue *Queue
+
+	// IgnoreSenders are the Github users whose changes are ignored, so
+	// that the changes ghira makes itself don't trigger a sync.
+	IgnoreSenders []string
+
+	deliveries recentSet
+}
+
+type githubPayload struct {
+	Action string `json:"action"`
+	Issue  *struct {
+		Number      int `json:"number"`
+		PullRequest any `json:"pull_request"`
+	} `json:"issue"`
+	PullRequest *struct {
+		Number int    `json:"number"`
+		Body   string `json:"body"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+}
+
+func (h *Github) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, "unable to read the payload", http.StatusBadRequest)
+		return
+	}
+
+	if !validSignature(h.Secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		slog.Warn("Rejected a Github delivery with an invalid signature", "remote_addr", r.RemoteAddr)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	delivery := r.Header.Get("X-GitHub-Delivery")
+	logger := slog.With("event", event, "delivery", delivery)
+
+	var numbers []int
+	switch event {
+	case "ping":
+		io.WriteString(w, "pong\n")
+		return
+	case "issues", "issue_comment", "pull_request":
+		var payload githubPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		if !strings.EqualFold(payload.Repository.FullName, h.Repository) {
+			logger.Info("Ignoring a Github delivery about another repository", "delivery_repo", payload.Repository.FullName)
+			io.WriteString(w, "ignored\n")
+			return
+		}
+		if slices.Contains(h.IgnoreSenders, payload.Sender.Login) {
+			logger.Debug("Ignoring a Github delivery about an own change", "sender", payload.Sender.Login)
+			io.WriteString(w, "ignored\n")
+			return
+		}
+		numbers = affectedIssues(payload)
+	default:
+		io.WriteString(w, "ignored\n")
+		return
+	}
+
+	// Deliveries without an ID can't be told apart: they are never
+	// duplicates.
+	if delivery != "" && !h.deliveries.Add(delivery) {
+		logger.Info("Ignoring a duplicate Github delivery")
+		io.WriteString(w, "duplicate delivery\n")
+		return
+	}
+	logger.Info("Received a Github delivery", "action", "webhook", "gh_numbers", numbers)
+	h.Queue.Add(numbers...)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// affectedIssues returns the numbers of the issues to sync after a
+// delivery. Comments on pull requests are ignored; pull requests affect the
+// issues they close.
+func affectedIssues(payload githubPayload) []int {
+	switch {
+	case payload.Issue != nil && payload.Issue.PullRequest == nil:
+		return []int{payload.Issue.Number}
+	case payload.PullRequest != nil:
+		var numbers []int
+		for _, m := range closingKeywordRegex.FindAllStringSubmatch(payload.PullRequest.Body, -1) {
+			if n, err := strconv.Atoi(m[1]); err == nil {
+				numbers = append(numbers, n)
+			}
+		}
+		return numbers
+	}
+	return nil
+}
+
+// validSignature checks a "sha256=<hex>" HMAC of the body.
+func validSignature(secret, body []byte, signature string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
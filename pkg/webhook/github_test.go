@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGithub(t *testing.T) {
+	const secret = "s3cr3t"
+
+	for _, tc := range [...]struct {
+		name       string
+		event      string
+		delivery   string
+		body       string
+		signature  string
+		wantStatus int
+		wantQueued []int
+	}{
+		{
+			name:       "issue event",
+			event:      "issues",
+			body:       `{"action":"closed","issue":{"number":12},"repository":{"full_name":"o/r"}}`,
+			wantStatus: http.StatusAccepted,
+			wantQueued: []int{12},
+		},
+		{
+			name:       "invalid signature",
+			event:      "issues",
+			body:       `{"action":"closed","issue":{"number":12},"repository":{"full_name":"o/r"}}`,
+			signature:  sign("wrong", `{}`),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing signature",
+			event:      "issues",
+			body:       `{"action":"closed","issue":{"number":12},"repository":{"full_name":"o/r"}}`,
+			signature:  "-",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "comment on a pull request",
+			event:      "issue_comment",
+			body:       `{"action":"created","issue":{"number":3,"pull_request":{}},"repository":{"full_name":"o/r"}}`,
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "pull request closing issues",
+			event:      "pull_request",
+			body:       `{"action":"closed","pull_request":{"number":5,"body":"Fixes #1, closes: #2\nsee #3"},"repository":{"full_name":"o/r"}}`,
+			wantStatus: http.StatusAccepted,
+			wantQueued: []int{1, 2},
+		},
+		{
+			name:       "other repository",
+			event:      "issues",
+			body:       `{"action":"closed","issue":{"number":12},"repository":{"full_name":"o/other"}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "own change",
+			event:      "issues",
+			body:       `{"action":"closed","issue":{"number":12},"repository":{"full_name":"o/r"},"sender":{"login":"ghira-bot"}}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "ping",
+			event:      "ping",
+			body:       `{"zen":"Keep it logically awesome."}`,
+			wantStatus: http.StatusOK,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var queued []int
+			h := &Github{
+				Secret:        []byte(secret),
+				Repository:    "o/r",
+				IgnoreSenders: []string{"ghira-bot"},
+				Queue: NewQueue(func(_ context.Context, number int) {
+					queued = append(queued, number)
+				}),
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(tc.body))
+			req.Header.Set("X-GitHub-Event", tc.event)
+			req.Header.Set("X-GitHub-Delivery", "d1")
+			switch tc.signature {
+			case "":
+				req.Header.Set("X-Hub-Signature-256", sign(secret, tc.body))
+			case "-":
+			default:
+				req.Header.Set("X-Hub-Signature-256", tc.signature)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body)
+			}
+
+			for n, ok := h.Queue.next(); ok; n, ok = h.Queue.next() {
+				h.Queue.sync(context.Background(), n)
+			}
+			if !slices.Equal(queued, tc.wantQueued) {
+				t.Errorf("expected queued %v, got %v", tc.wantQueued, queued)
+			}
+		})
+	}
+}
+
+func TestGithubDeduplicatesDeliveries(t *testing.T) {
+	const body = `{"action":"closed","issue":{"number":12},"repository":{"full_name":"o/r"}}`
+	h := &Github{
+		Secret:     []byte("s3cr3t"),
+		Repository: "o/r",
+		Queue:      NewQueue(nil),
+	}
+
+	for _, want := range []int{http.StatusAccepted, http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", "issues")
+		req.Header.Set("X-GitHub-Delivery", "d1")
+		req.Header.Set("X-Hub-Signature-256", sign("s3cr3t", body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("expected status %d, got %d", want, rec.Code)
+		}
+	}
+}
+
+func TestGithubDeliveryWithoutID(t *testing.T) {
+	const body = `{"action":"closed","issue":{"number":12},"repository":{"full_name":"o/r"}}`
+	h := &Github{
+		Secret:     []byte("s3cr3t"),
+		Repository: "o/r",
+		Queue:      NewQueue(nil),
+	}
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", "issues")
+		req.Header.Set("X-Hub-Signature-256", sign("s3cr3t", body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("expected the deliveries without ID to be accepted, got %d", rec.Code)
+		}
+	}
+}
+
+func TestRecentSetAddConcurrent(t *testing.T) {
+	var (
+		s     recentSet
+		wg    sync.WaitGroup
+		added atomic.Int32
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.Add("d1") {
+				added.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := added.Load(); n != 1 {
+		t.Errorf("expected the delivery to be added once, got %d", n)
+	}
+}
+
+func TestQueueCoalesces(t *testing.T) {
+	q := NewQueue(nil)
+	q.Add(1, 2, 1)
+	q.Add(2, 3)
+
+	var got []int
+	for n, ok := q.next(); ok; n, ok = q.next() {
+		got = append(got, n)
+	}
+	if want := []int{1, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
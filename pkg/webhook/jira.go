@@ -0,0 +1,260 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/shiftstack/ghira/pkg/reverse"
+)
+
+// Jira handles the "jira:issue_updated" and "comment_created" deliveries of
+// a Jira Cloud webhook, and submits them to the reverse-sync pipeline.
+//
+// Deliveries are authenticated either with the X-Hub-Signature HMAC of a
+// webhook configured with a secret, or with the JWT that Jira sends to
+// Connect apps, signed with the shared secret.
+type Jira struct {
+	Secret []byte
+
+	// IssueNumber returns the number of the Github issue mirrored by the
+	// Jira issue with the given key and summary. Deliveries about other
+	// issues are ignored.
+	IssueNumber func(key, summary string) (int, bool)
+
+	Pipeline *reverse.Pipeline
+
+	// IgnoreActors are the Jira accounts whose changes are ignored, so
+	// that the changes ghira makes itself are not carried back to Github.
+	IgnoreActors []string
+
+	deliveries recentSet
+}
+
+type jiraUser struct {
+	AccountID string `json:"accountId"`
+}
+
+type jiraPayload struct {
+	Timestamp    int64    `json:"timestamp"`
+	WebhookEvent string   `json:"webhookEvent"`
+	User         jiraUser `json:"user"`
+	Issue        struct {
+		Key    string `json:"key"`
+		Fields struct {
+			Summary string `json:"summary"`
+			Status  struct {
+				Name           string `json:"name"`
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"status"`
+			Resolution *struct {
+				Name string `json:"name"`
+			} `json:"resolution"`
+		} `json:"fields"`
+	} `json:"issue"`
+	Changelog struct {
+		Items []struct {
+			Field      string `json:"field"`
+			From       string `json:"from"`
+			FromString string `json:"fromString"`
+			To         string `json:"to"`
+			ToString   string `json:"toString"`
+		} `json:"items"`
+	} `json:"changelog"`
+	Comment *struct {
+		ID     string   `json:"id"`
+		Author jiraUser `json:"author"`
+		Body   string   `json:"body"`
+	} `json:"comment"`
+}
+
+func (h *Jira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, "unable to read the payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authenticate(r, body); err != nil {
+		slog.Warn("Rejected a Jira delivery", "remote_addr", r.RemoteAddr, "error", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	delivery := r.Header.Get("X-Atlassian-Webhook-Identifier")
+
+	var payload jiraPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	event, ok := h.toEvent(payload)
+	if !ok {
+		io.WriteString(w, "ignored\n")
+		return
+	}
+	if slices.Contains(h.IgnoreActors, event.Actor) {
+		slog.Debug("Ignoring a Jira delivery about an own change", "jira_key", event.Key, "actor", event.Actor)
+		io.WriteString(w, "ignored\n")
+		return
+	}
+
+	logger := slog.With("gh_number", event.Number, "jira_key", event.Key, "event", event.Kind, "delivery", delivery)
+	if delivery != "" && !h.deliveries.Add(delivery) {
+		logger.Info("Ignoring a duplicate Jira delivery")
+		io.WriteString(w, "duplicate delivery\n")
+		return
+	}
+	if !h.Pipeline.Submit(event) {
+		// Jira retries the deliveries that fail with a 5xx.
+		logger.Warn("The reverse-sync pipeline is full: rejecting the Jira delivery")
+		if delivery != "" {
+			h.deliveries.Remove(delivery)
+		}
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+		return
+	}
+	logger.Info("Received a Jira delivery", "action", "webhook")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// toEvent converts a payload to an event. It returns false if the delivery
+// is not about a mirrored issue, or is of an unsupported kind.
+func (h *Jira) toEvent(payload jiraPayload) (reverse.Event, bool) {
+	number, ok := h.IssueNumber(payload.Issue.Key, payload.Issue.Fields.Summary)
+	if !ok {
+		return reverse.Event{}, false
+	}
+
+	event := reverse.Event{
+		Number: number,
+		Key:    payload.Issue.Key,
+		Actor:  payload.User.AccountID,
+		At:     time.UnixMilli(payload.Timestamp),
+		Status: payload.Issue.Fields.Status.Name,
+
+		StatusCategory: payload.Issue.Fields.Status.StatusCategory.Key,
+	}
+	if resolution := payload.Issue.Fields.Resolution; resolution != nil {
+		event.Resolution = resolution.Name
+	}
+	switch payload.WebhookEvent {
+	case "jira:issue_updated":
+		event.Kind = reverse.IssueUpdated
+		for _, item := range payload.Changelog.Items {
+			event.Changes = append(event.Changes, reverse.Change{
+				Field:  item.Field,
+				From:   item.FromString,
+				To:     item.ToString,
+				FromID: item.From,
+				ToID:   item.To,
+			})
+		}
+	case "comment_created":
+		if payload.Comment == nil {
+			return reverse.Event{}, false
+		}
+		event.Kind = reverse.CommentCreated
+		event.Comment = &reverse.Comment{
+			ID:     payload.Comment.ID,
+			Author: payload.Comment.Author.AccountID,
+			Body:   payload.Comment.Body,
+		}
+		if event.Actor == "" {
+			event.Actor = payload.Comment.Author.AccountID
+		}
+	default:
+		return reverse.Event{}, false
+	}
+	return event, true
+}
+
+func (h *Jira) authenticate(r *http.Request, body []byte) error {
+	if signature := r.Header.Get("X-Hub-Signature"); signature != "" {
+		if !validSignature(h.Secret, body, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "JWT "); ok {
+		return validateJWT(h.Secret, token, r)
+	}
+	if token := r.URL.Query().Get("jwt"); token != "" {
+		return validateJWT(h.Secret, token, r)
+	}
+
+	return errors.New("missing signature")
+}
+
+type connectClaims struct {
+	jwt.RegisteredClaims
+	QSH string `json:"qsh"`
+}
+
+// validateJWT checks an Atlassian Connect JWT: its HS256 signature, its
+// expiry, and its query string hash, which binds it to the request.
+//
+// https://developer.atlassian.com/cloud/jira/platform/understanding-jwt-for-connect-apps/
+func validateJWT(secret []byte, token string, r *http.Request) error {
+	var claims connectClaims
+	if _, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{"HS256"})); err != nil {
+		return fmt.Errorf("invalid JWT: %w", err)
+	}
+	if claims.ExpiresAt == nil {
+		return errors.New("invalid JWT: missing expiry")
+	}
+	if want := queryStringHash(r); claims.QSH != want {
+		return errors.New("invalid JWT: query string hash mismatch")
+	}
+	return nil
+}
+
+// queryStringHash computes the "qsh" claim of a request.
+func queryStringHash(r *http.Request) string {
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	path = strings.ReplaceAll(path, "&", "%26")
+
+	query := r.URL.Query()
+	query.Del("jwt")
+	params := make([]string, 0, len(query))
+	for _, k := range slices.Sorted(maps.Keys(query)) {
+		values := make([]string, 0, len(query[k]))
+		for _, v := range query[k] {
+			values = append(values, percentEncode(v))
+		}
+		slices.Sort(values)
+		params = append(params, percentEncode(k)+"="+strings.Join(values, ","))
+	}
+
+	canonical := strings.ToUpper(r.Method) + "&" + path + "&" + strings.Join(params, "&")
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
+
+// percentEncode encodes s as RFC 3986 requires.
+func percentEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
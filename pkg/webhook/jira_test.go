@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/shiftstack/ghira/pkg/reverse"
+)
+
+const jiraIssueUpdated = `{
+  "timestamp": 1700000000000,
+  "webhookEvent": "jira:issue_updated",
+  "user": {"accountId": "alice-id"},
+  "issue": {"key": "OSASINFRA-1", "fields": {"summary": "GH-orc-12: Title", "status": {"name": "Closed"}}},
+  "changelog": {"items": [{"field": "status", "from": "1", "fromString": "To Do", "to": "2", "toString": "Closed"}]}
+}`
+
+func issueNumber(_, summary string) (int, bool) {
+	s := regexp.MustCompile(`^GH-orc-(\d+): `).FindStringSubmatch(summary)
+	if len(s) < 2 {
+		return 0, false
+	}
+	n, _ := strconv.Atoi(s[1])
+	return n, true
+}
+
+func jiraRequest(target, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("X-Atlassian-Webhook-Identifier", "d1")
+	return req
+}
+
+func connectJWT(t *testing.T, secret string, req *http.Request, exp time.Time) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, connectClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "jira",
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+		QSH: queryStringHash(req),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestJira(t *testing.T) {
+	const secret = "s3cr3t"
+
+	for _, tc := range [...]struct {
+		name       string
+		target     string
+		body       string
+		auth       func(t *testing.T, req *http.Request)
+		wantStatus int
+		wantEvent  bool
+	}{
+		{
+			name: "HMAC signature",
+			body: jiraIssueUpdated,
+			auth: func(_ *testing.T, req *http.Request) {
+				req.Header.Set("X-Hub-Signature", sign(secret, jiraIssueUpdated))
+			},
+			wantStatus: http.StatusAccepted,
+			wantEvent:  true,
+		},
+		{
+			name: "invalid HMAC signature",
+			body: jiraIssueUpdated,
+			auth: func(_ *testing.T, req *http.Request) {
+				req.Header.Set("X-Hub-Signature", sign("wrong", jiraIssueUpdated))
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "JWT",
+			target: "/webhooks/jira?user_id=alice&b=2",
+			body:   jiraIssueUpdated,
+			auth: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "JWT "+connectJWT(t, secret, req, time.Now().Add(time.Minute)))
+			},
+			wantStatus: http.StatusAccepted,
+			wantEvent:  true,
+		},
+		{
+			name: "expired JWT",
+			body: jiraIssueUpdated,
+			auth: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "JWT "+connectJWT(t, secret, req, time.Now().Add(-time.Minute)))
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "JWT for another request",
+			body: jiraIssueUpdated,
+			auth: func(t *testing.T, req *http.Request) {
+				other := httptest.NewRequest(http.MethodPost, "/other", nil)
+				req.Header.Set("Authorization", "JWT "+connectJWT(t, secret, other, time.Now().Add(time.Minute)))
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unauthenticated",
+			body:       jiraIssueUpdated,
+			auth:       func(*testing.T, *http.Request) {},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "own change",
+			body: strings.Replace(jiraIssueUpdated, "alice-id", "ghira-id", 1),
+			auth: func(_ *testing.T, req *http.Request) {
+				req.Header.Set("X-Hub-Signature", sign(secret, strings.Replace(jiraIssueUpdated, "alice-id", "ghira-id", 1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "issue not mirroring a Github issue",
+			body: strings.Replace(jiraIssueUpdated, "GH-orc-12: ", "", 1),
+			auth: func(_ *testing.T, req *http.Request) {
+				req.Header.Set("X-Hub-Signature", sign(secret, strings.Replace(jiraIssueUpdated, "GH-orc-12: ", "", 1)))
+			},
+			wantStatus: http.StatusOK,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []reverse.Event
+			pipeline := reverse.NewPipeline(1, reverse.HandlerFunc(func(_ context.Context, event reverse.Event) error {
+				got = append(got, event)
+				return nil
+			}))
+			h := &Jira{
+				Secret:       []byte(secret),
+				IssueNumber:  issueNumber,
+				Pipeline:     pipeline,
+				IgnoreActors: []string{"ghira-id"},
+			}
+
+			target := tc.target
+			if target == "" {
+				target = "/webhooks/jira"
+			}
+			req := jiraRequest(target, tc.body)
+			tc.auth(t, req)
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			pipeline.Run(ctx)
+
+			if !tc.wantEvent {
+				if len(got) != 0 {
+					t.Errorf("expected no event, got %+v", got)
+				}
+				return
+			}
+			if len(got) != 1 {
+				t.Fatalf("expected 1 event, got %d", len(got))
+			}
+			e := got[0]
+			if e.Kind != reverse.IssueUpdated || e.Number != 12 || e.Key != "OSASINFRA-1" || e.Actor != "alice-id" || e.Status != "Closed" {
+				t.Errorf("unexpected event: %+v", e)
+			}
+			if len(e.Changes) != 1 || e.Changes[0] != (reverse.Change{Field: "status", From: "To Do", To: "Closed", FromID: "1", ToID: "2"}) {
+				t.Errorf("unexpected changes: %+v", e.Changes)
+			}
+		})
+	}
+}
+
+func TestJiraPipelineFull(t *testing.T) {
+	h := &Jira{
+		Secret:      []byte("s3cr3t"),
+		IssueNumber: issueNumber,
+		Pipeline:    reverse.NewPipeline(0),
+	}
+
+	for _, want := range []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable} {
+		req := jiraRequest("/webhooks/jira", jiraIssueUpdated)
+		req.Header.Set("X-Hub-Signature", sign("s3cr3t", jiraIssueUpdated))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		// A rejected delivery is not recorded, so that its retry goes
+		// through.
+		if rec.Code != want {
+			t.Errorf("expected status %d, got %d", want, rec.Code)
+		}
+	}
+}
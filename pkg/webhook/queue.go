@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// recentSetSize is the number of delivery IDs remembered for deduplication.
+const recentSetSize = 1000
+
+// recentSet remembers the last recentSetSize values added to it.
+type recentSet struct {
+	mu     sync.Mutex
+	values map[string]struct{}
+	order  []string
+}
+
+// Add adds v, and reports whether it was not there yet. Concurrent calls with
+// the same value return true only once.
+func (s *recentSet) Add(v string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]struct{})
+	}
+	if _, ok := s.values[v]; ok {
+		return false
+	}
+	if len(s.order) >= recentSetSize {
+		delete(s.values, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.values[v] = struct{}{}
+	s.order = append(s.order, v)
+	return true
+}
+
+// Remove forgets v.
+func (s *recentSet) Remove(v string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[v]; !ok {
+		return
+	}
+	delete(s.values, v)
+	s.order = slices.DeleteFunc(s.order, func(o string) bool { return o == v })
+}
+
+// Queue syncs the enqueued issues one at a time, in order. An issue that is
+// already waiting is not enqueued again.
+type Queue struct {
+	sync func(ctx context.Context, number int)
+
+	mu      sync.Mutex
+	pending []int
+	queued  map[int]bool
+	wake    chan struct{}
+}
+
+// NewQueue returns a queue that calls sync for each issue.
+func NewQueue(sync func(ctx context.Context, number int)) *Queue {
+	return &Queue{
+		sync:   sync,
+		queued: make(map[int]bool),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Add enqueues issues. It doesn't block.
+func (q *Queue) Add(numbers ...int) {
+	q.mu.Lock()
+	for _, n := range numbers {
+		if !q.queued[n] {
+			q.queued[n] = true
+			q.pending = append(q.pending, n)
+		}
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) next() (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return 0, false
+	}
+	n := q.pending[0]
+	q.pending = q.pending[1:]
+	delete(q.queued, n)
+	return n, true
+}
+
+// Run syncs the enqueued issues until ctx is cancelled.
+func (q *Queue) Run(ctx context.Context) {
+	for {
+		for n, ok := q.next(); ok; n, ok = q.next() {
+			if ctx.Err() != nil {
+				return
+			}
+			q.sync(ctx, n)
+		}
+
+		select {
+		case <-q.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
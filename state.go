@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/shiftstack/bugwatcher/pkg/query"
+	"github.com/shiftstack/ghira/pkg/jiraclient"
+	"github.com/shiftstack/ghira/pkg/state"
+)
+
+const stateUsage = `Usage:
+  ghira state export -state-file FILE             Write the state as JSON to stdout.
+  ghira state import -state-file FILE [EXPORT]    Replace the state with an export, read from stdin by default.
+  ghira state rebuild -state-file FILE            Rebuild the state from the Jira issues.
+`
+
+// stateCommand runs "ghira state", which manages the state file, and returns
+// the exit code.
+func stateCommand(args []string) int {
+	handler, _ := newLogHandler("text", slog.LevelInfo)
+	slog.SetDefault(slog.New(handler).With("repo", githubRepository))
+
+	flags := flag.NewFlagSet("state", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), stateUsage) }
+	stateFile := flags.String("state-file", "", "Path of the state file.")
+
+	if len(args) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	command := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	if *stateFile == "" {
+		slog.Error("Missing the path of the state file: set -state-file")
+		return exitUsage
+	}
+
+	store, err := state.Open(*stateFile)
+	if err != nil {
+		slog.Error("Unable to open the state file", "error", err)
+		return exitFatal
+	}
+
+	switch command {
+	case "export":
+		if err := store.Export(os.Stdout); err != nil {
+			slog.Error("Unable to export the state", "error", err)
+			return exitFatal
+		}
+		return 0
+
+	case "import":
+		var in io.Reader = os.Stdin
+		if path := flags.Arg(0); path != "" && path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				slog.Error("Unable to open the export", "error", err)
+				return exitFatal
+			}
+			defer f.Close()
+			in = f
+		}
+		if err := store.Import(in); err != nil {
+			slog.Error("Unable to import the state", "error", err)
+			return exitFatal
+		}
+
+	case "rebuild":
+		if JIRA_EMAIL == "" || JIRA_TOKEN == "" {
+			slog.Error("Required environment variables not found", "variables", []string{"JIRA_EMAIL", "JIRA_TOKEN"})
+			return exitUsage
+		}
+		jiraClient, err := jiraclient.NewWithToken(query.JiraBaseURL, JIRA_EMAIL, JIRA_TOKEN, nil, time.Minute)
+		if err != nil {
+			slog.Error("Unable to build a Jira client", "error", err)
+			return exitFatal
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		n, err := state.Rebuild(ctx, store, newTracker(jiraClient), githubRepository)
+		if err != nil {
+			slog.Error("Unable to rebuild the state", "error", err)
+			return exitFatal
+		}
+		slog.Info("Rebuilt the state from Jira", "count", n)
+
+	default:
+		flags.Usage()
+		return exitUsage
+	}
+
+	if err := store.Save(); err != nil {
+		slog.Error("Unable to save the state", "error", err)
+		return exitFatal
+	}
+	return 0
+}